@@ -5,117 +5,320 @@ import (
 	"fmt"
 	VaultApi "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"path"
-	"path/filepath"
-	"reflect"
+	"strconv"
+	"strings"
 )
 
-// type AuditDevice struct {
-//   Type string `json:"type"`
-//   Description string `json:"description"`
-//   Options map[string]interface{} `json:"options"`
-// }
+// AuditDevice is the configuration of an audit device. Vault takes every
+// option as a string, but options can be configured as booleans or numbers too
+type AuditDevice struct {
+	Type        string                 `json:"type" yaml:"type"`
+	Description string                 `json:"description" yaml:"description"`
+	Options     map[string]interface{} `json:"options" yaml:"options"`
+	Local       bool                   `json:"local" yaml:"local"`
+}
 
 type AuditDeviceList map[string]VaultApi.EnableAuditOptions
 
+// Suffix of the temporary path an audit device is enabled at while it is
+// being reconfigured
+const auditDeviceTempSuffix = "-vault-admin-tmp"
+
 func SyncAuditDevices() {
 
 	auditDeviceList := AuditDeviceList{}
 
 	log.Info("Syncing Audit Devices")
-	GetAuditDevices(auditDeviceList)
+	skippedDevices := GetAuditDevices(auditDeviceList)
 	ConfigureAuditDevices(auditDeviceList)
-	CleanupAuditDevices(auditDeviceList)
+	CleanupAuditDevices(auditDeviceList, skippedDevices)
 }
 
-func GetAuditDevices(auditDeviceList AuditDeviceList) {
-	files, err := ioutil.ReadDir(Spec.ConfigurationPath + "/audit_devices/")
-	if err != nil {
-		log.Warn("No audit devices found: ", err)
-		return
-	}
+// GetAuditDevices reads in the audit device configuration. The paths of audit
+// devices that are skipped because their secret substitution failed are
+// returned so they aren't cleaned up
+func GetAuditDevices(auditDeviceList AuditDeviceList) SecretList {
+	skippedDevices := SecretList{}
+	for _, entry := range loadConfigDirectory(path.Join(Spec.ConfigurationPath, "audit_devices"), isConfigFile, false) {
+		content, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	for _, file := range files {
+		// Perform any substitutions
+		contentstring := string(content)
+		success, errMsg := performSubstitutions(&contentstring, "audit/"+entry.Name)
+		if !success {
+			log.Warn(errMsg)
+			log.Warn("Secret substitution failed for [" + entry.Path + "], skipping audit device [" + entry.Name + "/]")
+			skippedDevices.Add(entry.Name + "/")
+			continue
+		}
 
-		if checkExt(file.Name(), ".json") {
-			content, err := ioutil.ReadFile(Spec.ConfigurationPath + "/audit_devices/" + file.Name())
-			if err != nil {
-				log.Fatal(err)
-			}
+		checkSubstitutedTypes(contentstring, "audit-device", "Audit device ["+entry.Name+"/]")
 
-			if !isJSON(string(content)) {
-				log.Fatal("Audit device configuration not valid JSON: ", file.Name())
-			}
+		var m AuditDevice
 
-			var m VaultApi.EnableAuditOptions
+		// Use the filename (and any subdirectories) as the mount path
+		err = json.Unmarshal([]byte(contentstring), &m)
+		if err != nil {
+			log.Fatal("Error parsing audit device configuration: ", entry.Path, " ", err)
+		}
 
-			// Use the filename as the mount path
-			filename := file.Name()
-			path := filename[0:len(filename)-len(filepath.Ext(filename))] + "/"
-			err = json.Unmarshal([]byte(content), &m)
-			if err != nil {
-				log.Fatal("Error parsing audit device configuration: ", file.Name(), " ", err)
-			}
+		auditDeviceList[entry.Name+"/"] = m.enableAuditOptions()
+	}
 
-			auditDeviceList[path] = m
-		} else {
-			log.Warn("Audit file has wrong extension.  Will not be processed: ", Spec.ConfigurationPath+"/audit_devices/"+file.Name())
-		}
+	return skippedDevices
+}
+
+// enableAuditOptions converts the audit device configuration into the options
+// for enabling it, with all the options as strings
+func (d AuditDevice) enableAuditOptions() VaultApi.EnableAuditOptions {
+	options := make(map[string]string, len(d.Options))
+	for k, v := range d.Options {
+		options[k] = auditOptionString(v)
 	}
+
+	return VaultApi.EnableAuditOptions{Type: d.Type, Description: d.Description, Options: options, Local: d.Local}
+}
+
+// auditOptionString formats an audit device option value as a string
+func auditOptionString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+
+	jsonValue, _ := json.Marshal(value)
+	return string(jsonValue)
 }
 
 func ConfigureAuditDevices(auditDeviceList AuditDeviceList) {
 	for mountPath, auditDevice := range auditDeviceList {
 
 		// Check if mount is enabled
-		create := false
-		recreate := false
 		existingDevices, _ := VaultSys.ListAudit()
-		if _, ok := existingDevices[mountPath]; ok {
-			if existingDevices[mountPath].Type != auditDevice.Type || !reflect.DeepEqual(existingDevices[mountPath].Options, auditDevice.Options) || existingDevices[mountPath].Description != auditDevice.Description {
+		if _, ok := existingDevices[auditDeviceTempPath(mountPath)]; ok {
+			if !configureTempAuditDevice(mountPath, auditDevice, existingDevices) {
+				continue
+			}
+			existingDevices, _ = VaultSys.ListAudit()
+		}
+
+		if existingDevice, ok := existingDevices[mountPath]; ok {
+			if !auditDeviceMatches(existingDevice, auditDevice) {
 				log.Info("Audit device [" + mountPath + "] exists but doesn't match configuration.  Must recreate to update.")
 				if askForConfirmation("Recreate audit device ["+mountPath+"] to reconfigure [y/n]?: ", 3) {
-					err := VaultSys.DisableAudit(mountPath)
-					if err != nil {
-						log.Fatal("Error deleting audit device ["+mountPath+"]", err)
-					}
-					log.Info("Audit device [" + mountPath + "] deleted")
-					recreate = true
+					reconfigureAuditDevice(mountPath, auditDevice)
 				} else {
 					log.Info("Leaving [" + mountPath + "] even though it does not match configuration")
 				}
 			}
 		} else {
-			create = true
+			log.Debug("Enabling audit device [" + mountPath + "]")
+			enableAuditDevice(mountPath, auditDevice)
 		}
+	}
+}
 
-		if create || recreate {
-			log.Debug("Enabling audit device [" + mountPath + "]")
-			err := VaultSys.EnableAuditWithOptions(mountPath, &auditDevice)
-			if err != nil {
-				log.Fatal("Error enabling audit device ["+mountPath+"]", err)
-			}
-			log.Info("Audit device [" + mountPath + "] enabled")
+// auditDeviceTempPath returns the temporary path an audit device is enabled
+// at while it is being reconfigured
+func auditDeviceTempPath(mountPath string) string {
+	return strings.TrimSuffix(mountPath, "/") + auditDeviceTempSuffix + "/"
+}
+
+// configureTempAuditDevice handles an audit device found at its temporary
+// path, either left there by --audit-skip-reenable or by an interrupted run.
+// A device that matches its configuration, with nothing at the original path,
+// stays there while --audit-skip-reenable is set and is otherwise moved back.
+// Any other temporary device is removed, once the original path has a device
+// so auditing isn't interrupted. Returns whether the device at the original
+// path still needs to be configured
+func configureTempAuditDevice(mountPath string, auditDevice VaultApi.EnableAuditOptions, existingDevices map[string]*VaultApi.Audit) bool {
+	tempPath := auditDeviceTempPath(mountPath)
+
+	if _, ok := existingDevices[mountPath]; ok {
+		log.Infof("Removing temporary audit device [%s] left by an earlier run", tempPath)
+		disableTempAuditDevice(tempPath)
+		return true
+	}
+
+	if auditDeviceMatches(existingDevices[tempPath], auditDevice) && Spec.AuditSkipReenable {
+		log.Infof("Audit device [%s] is at temporary path [%s], leaving it there", mountPath, tempPath)
+		return false
+	}
+
+	log.Infof("Moving audit device [%s] back from temporary path [%s]", mountPath, tempPath)
+	enableAuditDevice(mountPath, auditDevice)
+	disableTempAuditDevice(tempPath)
+	return false
+}
+
+// disableTempAuditDevice removes an audit device from its temporary path
+func disableTempAuditDevice(tempPath string) {
+	err := VaultSys.DisableAudit(tempPath)
+	if err != nil {
+		log.Fatal("Error deleting temporary audit device ["+tempPath+"]", err)
+	}
+	log.Info("Temporary audit device [" + tempPath + "] deleted")
+}
+
+// auditDeviceMatches returns whether an existing audit device matches its configuration
+func auditDeviceMatches(existingDevice *VaultApi.Audit, auditDevice VaultApi.EnableAuditOptions) bool {
+	return existingDevice.Type == auditDevice.Type && auditOptionsMatch(existingDevice.Options, auditDevice.Options) && existingDevice.Description == auditDevice.Description
+}
+
+// auditOptionsMatch compares audit device options. Vault returns every option
+// as a string, so booleans and numbers are compared by value (i.e. "true"
+// matches "1" and "10" matches "10.0")
+func auditOptionsMatch(existing map[string]string, configured map[string]string) bool {
+	if len(existing) != len(configured) {
+		return false
+	}
+
+	for k, configuredValue := range configured {
+		existingValue, ok := existing[k]
+		if !ok {
+			return false
+		}
+		if existingValue == configuredValue {
+			continue
+		}
+
+		existingBool, existingErr := strconv.ParseBool(existingValue)
+		configuredBool, configuredErr := strconv.ParseBool(configuredValue)
+		if existingErr == nil && configuredErr == nil && existingBool == configuredBool {
+			continue
+		}
+
+		existingNumber, existingErr := strconv.ParseFloat(existingValue, 64)
+		configuredNumber, configuredErr := strconv.ParseFloat(configuredValue, 64)
+		if existingErr == nil && configuredErr == nil && existingNumber == configuredNumber {
+			continue
 		}
+
+		return false
+	}
+
+	return true
+}
+
+// reconfigureAuditDevice replaces an audit device without a gap in auditing.
+// Audit devices can't be updated, so the new configuration is enabled at a
+// temporary path and verified before the old device is disabled. It's then
+// moved back to the original path, unless --audit-skip-reenable is set in
+// which case it stays at the temporary path and the original path is left
+// empty (see configureTempAuditDevice)
+func reconfigureAuditDevice(mountPath string, auditDevice VaultApi.EnableAuditOptions) {
+	tempPath := auditDeviceTempPath(mountPath)
+
+	existingDevices, err := VaultSys.ListAudit()
+	if err != nil {
+		log.Fatal("Error listing audit devices: ", err)
+	}
+	if _, ok := existingDevices[tempPath]; ok {
+		log.Fatalf("Temporary audit device [%s] already exists (from an earlier run?), it must be removed before [%s] can be reconfigured", tempPath, mountPath)
+	}
+
+	log.Infof("Enabling new configuration for audit device [%s] at temporary path [%s]", mountPath, tempPath)
+	enableAuditDevice(tempPath, auditDevice)
+
+	err = VaultSys.DisableAudit(mountPath)
+	if err != nil {
+		log.Fatal("Error deleting audit device ["+mountPath+"]", err)
+	}
+	log.Info("Audit device [" + mountPath + "] deleted")
+
+	if Spec.AuditSkipReenable {
+		log.Infof("Audit device [%s] left at temporary path [%s]", mountPath, tempPath)
+		return
+	}
+
+	enableAuditDevice(mountPath, auditDevice)
+	disableTempAuditDevice(tempPath)
+}
+
+// enableAuditDevice enables an audit device and verifies that it is enabled.
+// Vault checks the device (i.e. that a file can be written) when enabling it
+func enableAuditDevice(mountPath string, auditDevice VaultApi.EnableAuditOptions) {
+	err := VaultSys.EnableAuditWithOptions(mountPath, &auditDevice)
+	if err != nil {
+		log.Fatal("Error enabling audit device ["+mountPath+"]", err)
 	}
+
+	existingDevices, err := VaultSys.ListAudit()
+	if err != nil {
+		log.Fatal("Error listing audit devices: ", err)
+	}
+	if existingDevice, ok := existingDevices[mountPath]; !ok || existingDevice.Type != auditDevice.Type {
+		log.Fatalf("Audit device [%s] was not enabled", mountPath)
+	}
+
+	log.Info("Audit device [" + mountPath + "] enabled")
 }
 
-func CleanupAuditDevices(auditDeviceList AuditDeviceList) {
+func CleanupAuditDevices(auditDeviceList AuditDeviceList, skippedDevices SecretList) {
+
+	// Vault blocks all requests if there are no audit devices left to log
+	// them, so an empty configuration leaves the existing devices alone
+	if len(auditDeviceList) == 0 {
+		log.Warn("There are no audit devices in the configuration, skipping audit device cleanup")
+		return
+	}
 
 	existingDevices, _ := VaultSys.ListAudit()
 
 	for mountPath, _ := range existingDevices {
 
+		// Temporary devices of configured audit devices are handled when
+		// they're configured
+		originalPath := strings.TrimSuffix(mountPath, auditDeviceTempSuffix+"/") + "/"
+		_, isTempDevice := auditDeviceList[originalPath]
+		isTempDevice = isTempDevice && auditDeviceTempPath(originalPath) == mountPath
+
 		if _, ok := auditDeviceList[mountPath]; ok {
 			log.Debug("Audit device [" + mountPath + "] exists in configuration, no cleanup necessary")
+		} else if isTempDevice {
+			log.Debug("Audit device [" + mountPath + "] is the temporary path of [" + originalPath + "], no cleanup necessary")
+		} else if skippedDevices.Contains(mountPath) {
+			log.Warn("Audit device [" + mountPath + "] was skipped, leaving it in place")
 		} else {
 			auditPath := path.Join("sys/audit", mountPath)
-			task := taskDelete{
-				Description: fmt.Sprintf("Audit device [%s]", auditPath),
-				Path:        auditPath,
+			task := taskDeleteAuditDevice{
+				taskDelete: taskDelete{
+					Description: fmt.Sprintf("Audit device [%s]", auditPath),
+					Path:        auditPath,
+				},
 			}
 			taskPromptChan <- task
 		}
 	}
 }
+
+// taskDeleteAuditDevice prompts to delete an audit device. The audit devices
+// are checked again when the prompt is run and deleting the last one is
+// refused, since Vault blocks all requests if there are none left to log them
+type taskDeleteAuditDevice struct {
+	taskDelete
+}
+
+func (t taskDeleteAuditDevice) run(workerNum int) bool {
+	existingDevices, err := VaultSys.ListAudit()
+	if err != nil {
+		log.Fatal("Error listing audit devices: ", err)
+	}
+
+	if len(existingDevices) <= 1 {
+		log.Warnf("Refusing to delete %s as it is the last audit device. Remove it manually if this is intended", t.Description)
+		return false
+	}
+
+	return t.taskDelete.run(workerNum)
+}
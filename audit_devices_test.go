@@ -0,0 +1,207 @@
+package main
+
+import (
+	VaultApi "github.com/hashicorp/vault/api"
+	"reflect"
+	"testing"
+)
+
+func TestCleanupAuditDevices(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured AuditDeviceList
+		skipped    SecretList
+		existing   []string
+		want       []string
+	}{
+		{
+			name:       "unconfigured device",
+			configured: AuditDeviceList{"file/": {Type: "file"}},
+			existing:   []string{"file/", "syslog/"},
+			want:       []string{"sys/audit/syslog"},
+		},
+		{
+			name:       "all configured",
+			configured: AuditDeviceList{"file/": {Type: "file"}},
+			existing:   []string{"file/"},
+		},
+		{
+			name:       "skipped device",
+			configured: AuditDeviceList{"file/": {Type: "file"}},
+			skipped:    SecretList{"syslog/"},
+			existing:   []string{"file/", "syslog/", "socket/"},
+			want:       []string{"sys/audit/socket"},
+		},
+		{
+			name:       "temporary device",
+			configured: AuditDeviceList{"file/": {Type: "file"}},
+			existing:   []string{"file-vault-admin-tmp/", "syslog-vault-admin-tmp/"},
+			want:       []string{"sys/audit/syslog-vault-admin-tmp"},
+		},
+		{
+			name:     "none configured",
+			existing: []string{"file/", "syslog/"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			vault.Data["sys/audit"] = testAuditDevices(test.existing)
+			collect := captureTasks(t)
+
+			CleanupAuditDevices(test.configured, test.skipped)
+
+			if got := collect().deletes; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CleanupAuditDevices() prompted to delete %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigureAuditDevicesTempDevice(t *testing.T) {
+	file := VaultApi.EnableAuditOptions{Type: "file"}
+	tests := []struct {
+		name         string
+		device       VaultApi.EnableAuditOptions
+		existing     []string
+		skipReenable bool
+		want         []string
+	}{
+		{
+			name:         "left by --audit-skip-reenable",
+			device:       file,
+			existing:     []string{"file-vault-admin-tmp/"},
+			skipReenable: true,
+			want:         []string{"file-vault-admin-tmp/"},
+		},
+		{
+			name:     "moved back",
+			device:   file,
+			existing: []string{"file-vault-admin-tmp/"},
+			want:     []string{"file/"},
+		},
+		{
+			name:         "left by an interrupted run",
+			device:       file,
+			existing:     []string{"file/", "file-vault-admin-tmp/"},
+			skipReenable: true,
+			want:         []string{"file/"},
+		},
+		{
+			name:         "outdated",
+			device:       VaultApi.EnableAuditOptions{Type: "file", Options: map[string]string{"file_path": "/vault/audit.log"}},
+			existing:     []string{"file-vault-admin-tmp/"},
+			skipReenable: true,
+			want:         []string{"file/"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			vault.Data["sys/audit"] = testAuditDevices(test.existing)
+			previous := Spec.AuditSkipReenable
+			Spec.AuditSkipReenable = test.skipReenable
+			defer func() { Spec.AuditSkipReenable = previous }()
+
+			ConfigureAuditDevices(AuditDeviceList{"file/": test.device})
+
+			var got []string
+			for mountPath := range vault.Data["sys/audit"] {
+				got = append(got, mountPath)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ConfigureAuditDevices() left audit devices %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeleteLastAuditDevice(t *testing.T) {
+	vault := newTestVault(t)
+	vault.Data["sys/audit"] = testAuditDevices([]string{"file/"})
+
+	task := taskDeleteAuditDevice{taskDelete: taskDelete{Description: "Audit device [sys/audit/file]", Path: "sys/audit/file"}}
+	if task.run(0) {
+		t.Error("taskDeleteAuditDevice.run() = true, want the last audit device to be kept")
+	}
+	if deletes := vault.requests("DELETE"); len(deletes) > 0 {
+		t.Errorf("taskDeleteAuditDevice.run() deleted %v", deletes)
+	}
+}
+
+func TestGetAuditDevices(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"audit_devices/file.yaml":   "type: file\noptions:\n  file_path: /vault/audit.log\n  log_raw: false\n  mode: \"0600\"\n",
+		"audit_devices/syslog.json": `{"type": "syslog", "options": {"tag": "%{env:VAULT_ADMIN_TEST_MISSING}%"}}`,
+	})
+	setSpec(t, &Spec.SubstitutionSource, "env")
+
+	auditDeviceList := AuditDeviceList{}
+	skipped := GetAuditDevices(auditDeviceList)
+
+	want := AuditDeviceList{"file/": {Type: "file", Options: map[string]string{"file_path": "/vault/audit.log", "log_raw": "false", "mode": "0600"}}}
+	if !reflect.DeepEqual(auditDeviceList, want) {
+		t.Errorf("GetAuditDevices() = %v, want %v", auditDeviceList, want)
+	}
+	if !reflect.DeepEqual(skipped, SecretList{"syslog/"}) {
+		t.Errorf("GetAuditDevices() skipped %v, want [syslog/]", skipped)
+	}
+}
+
+func TestAuditOptionsMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   map[string]string
+		configured map[string]string
+		want       bool
+	}{
+		{name: "equal", existing: map[string]string{"file_path": "/audit.log"}, configured: map[string]string{"file_path": "/audit.log"}, want: true},
+		{name: "empty", want: true},
+		{name: "different value", existing: map[string]string{"file_path": "/a.log"}, configured: map[string]string{"file_path": "/b.log"}},
+		{name: "booleans", existing: map[string]string{"log_raw": "1", "hmac_accessor": "false"}, configured: map[string]string{"log_raw": "true", "hmac_accessor": "0"}, want: true},
+		{name: "numbers", existing: map[string]string{"mode": "0600", "port": "10"}, configured: map[string]string{"mode": "600", "port": "10.0"}, want: true},
+		{name: "different boolean", existing: map[string]string{"log_raw": "true"}, configured: map[string]string{"log_raw": "false"}},
+		{name: "missing option", existing: map[string]string{"file_path": "/audit.log"}, configured: map[string]string{"file_path": "/audit.log", "log_raw": "true"}},
+		{name: "extra option", existing: map[string]string{"file_path": "/audit.log", "log_raw": "true"}, configured: map[string]string{"file_path": "/audit.log"}},
+		{name: "different key", existing: map[string]string{"a": "1"}, configured: map[string]string{"b": "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := auditOptionsMatch(test.existing, test.configured); got != test.want {
+				t.Errorf("auditOptionsMatch() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuditOptionString(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{value: "/audit.log", want: "/audit.log"},
+		{value: true, want: "true"},
+		{value: float64(8200), want: "8200"},
+		{value: 0.5, want: "0.5"},
+		{value: nil, want: ""},
+		{value: []interface{}{"a"}, want: `["a"]`},
+	}
+
+	for _, test := range tests {
+		if got := auditOptionString(test.value); got != test.want {
+			t.Errorf("auditOptionString(%v) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+// testAuditDevices returns the response listing audit devices at the given paths
+func testAuditDevices(mountPaths []string) map[string]interface{} {
+	devices := make(map[string]interface{})
+	for _, mountPath := range mountPaths {
+		devices[mountPath] = map[string]interface{}{"type": "file", "path": mountPath}
+	}
+	return devices
+}
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	VaultApi "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
+	"os"
 	"path"
-	"path/filepath"
+	"reflect"
 )
 
 type authMethod struct {
@@ -20,49 +20,41 @@ type authMethod struct {
 
 type authMethodList map[string]authMethod
 
+// authConfigPaths are the paths the config section is written to for auth
+// method types that don't use auth/<path>/config
+var authConfigPaths = map[string]string{
+	"aws": "config/client",
+}
+
 func SyncAuthMethods() {
 
 	authMethodList := authMethodList{}
 
 	log.Info("Syncing Auth Methods")
 	getAuthMethods(authMethodList)
+	checkUserpassPasswordOutput(authMethodList)
 	configureAuthMethods(authMethodList)
 	cleanupAuthMethods(authMethodList)
 }
 
 func getAuthMethods(authMethodList authMethodList) {
-	files, err := ioutil.ReadDir(Spec.ConfigurationPath + "/auth_methods/")
-	if err != nil {
-		log.Warn("No auth methods found: ", err)
-	}
-
-	for _, file := range files {
-
-		if checkExt(file.Name(), ".json") {
-			content, err := ioutil.ReadFile(Spec.ConfigurationPath + "/auth_methods/" + file.Name())
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			if !isJSON(string(content)) {
-				log.Fatal("Auth method configuration not valid JSON: ", file.Name())
-			}
-
-			var m authMethod
+	for _, entry := range loadConfigDirectory(path.Join(Spec.ConfigurationPath, "auth_methods"), isConfigFile, true) {
+		content, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			// Use the filename as the mount path
-			filename := file.Name()
-			m.Name = filename[0 : len(filename)-len(filepath.Ext(filename))]
-			m.Path = m.Name + "/"
-			err = json.Unmarshal([]byte(content), &m)
-			if err != nil {
-				log.Fatal("Error parsing auth method configuration: ", file.Name(), " ", err)
-			}
+		var m authMethod
 
-			authMethodList[m.Path] = m
-		} else {
-			log.Warn("Auth file has wrong extension.  Will not be processed: ", Spec.ConfigurationPath+"auth_methods/"+file.Name())
+		// Use the filename (and any subdirectories) as the mount path
+		m.Name = entry.Name
+		m.Path = m.Name + "/"
+		err = json.Unmarshal(content, &m)
+		if err != nil {
+			log.Fatal("Error parsing auth method configuration: ", entry.Path, " ", err)
 		}
+
+		authMethodList[m.Path] = m
 	}
 }
 
@@ -111,11 +103,11 @@ func configureAuthMethods(authMethodList authMethodList) {
 			success, errMsg := performSubstitutions(&contentstring, "auth/"+mount.Name)
 			if !success {
 				log.Warn(errMsg)
-				log.Warn("Secret substitution failed for [%s], skipping auth method configuration", mount.Path)
+				log.Warnf("Secret substitution failed for [%s], skipping auth method configuration", mount.Path)
 				return
 			} else {
 				if !isJSON(contentstring) {
-					log.Fatal("Auth engine [%s] is not a valid JSON after secret substitution", mount.Path)
+					log.Fatalf("Auth engine [%s] is not a valid JSON after secret substitution", mount.Path)
 				}
 
 				var configMap map[string]interface{}
@@ -124,6 +116,9 @@ func configureAuthMethods(authMethodList authMethodList) {
 				}
 
 				configPath := path.Join("auth", mount.Path, "config")
+				if p, ok := authConfigPaths[mount.AuthOptions.Type]; ok {
+					configPath = path.Join("auth", mount.Path, p)
+				}
 				task := taskWrite{
 					Path:        configPath,
 					Description: fmt.Sprintf("Auth mount config for [%s]", configPath),
@@ -143,10 +138,64 @@ func configureAuthMethods(authMethodList authMethodList) {
 		} else if mount.AuthOptions.Type == "jwt" || mount.AuthOptions.Type == "oidc" {
 			authMethodJWT := AuthMethodJWT{
 				Path:             path.Join("auth", mount.Path),
+				Name:             mount.Name,
 				AdditionalConfig: mount.AdditionalConfig,
 			}
 			log.Infof("Running additional configuration for [%s]", authMethodJWT.Path)
 			authMethodJWT.Configure()
+		} else if mount.AuthOptions.Type == "approle" {
+			authMethodAppRole := AuthMethodAppRole{
+				Path:             path.Join("auth", mount.Path),
+				Name:             mount.Name,
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodAppRole.Path)
+			authMethodAppRole.Configure()
+		} else if mount.AuthOptions.Type == "kubernetes" {
+			authMethodKubernetes := AuthMethodKubernetes{
+				Path:             path.Join("auth", mount.Path),
+				Name:             mount.Name,
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodKubernetes.Path)
+			authMethodKubernetes.Configure()
+		} else if mount.AuthOptions.Type == "aws" {
+			authMethodAWS := AuthMethodAWS{
+				Path:             path.Join("auth", mount.Path),
+				Name:             mount.Name,
+				Config:           mount.Config,
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodAWS.Path)
+			authMethodAWS.Configure()
+		} else if mount.AuthOptions.Type == "cert" {
+			authMethodCert := AuthMethodCert{
+				Path: path.Join("auth", mount.Path),
+				Name: mount.Name,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodCert.Path)
+			authMethodCert.Configure()
+		} else if mount.AuthOptions.Type == "github" {
+			authMethodGitHub := AuthMethodGitHub{
+				Path:             path.Join("auth", mount.Path),
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodGitHub.Path)
+			authMethodGitHub.Configure()
+		} else if mount.AuthOptions.Type == "okta" {
+			authMethodOkta := AuthMethodOkta{
+				Path:             path.Join("auth", mount.Path),
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodOkta.Path)
+			authMethodOkta.Configure()
+		} else if mount.AuthOptions.Type == "radius" {
+			authMethodRADIUS := AuthMethodRADIUS{
+				Path:             path.Join("auth", mount.Path),
+				AdditionalConfig: mount.AdditionalConfig,
+			}
+			log.Infof("Running additional configuration for [%s]", authMethodRADIUS.Path)
+			authMethodRADIUS.Configure()
 		} else {
 			log.Warn("Auth types other than LDAP not currently configurable, please open PR!")
 		}
@@ -174,3 +223,242 @@ func cleanupAuthMethods(authMethodList authMethodList) {
 		}
 	}
 }
+
+// authTokenFields are the token settings shared by the roles of most auth
+// methods. TTLs can be given as a number of seconds or a duration string (i.e. "1h")
+type authTokenFields struct {
+	// The set of CIDRs that tokens generated using this role will be bound to
+	TokenBoundCIDRs []string `json:"token_bound_cidrs" yaml:"token_bound_cidrs"`
+
+	TokenExplicitMaxTTL  duration `json:"token_explicit_max_ttl" yaml:"token_explicit_max_ttl"`
+	TokenMaxTTL          duration `json:"token_max_ttl" yaml:"token_max_ttl"`
+	TokenNoDefaultPolicy bool     `json:"token_no_default_policy" yaml:"token_no_default_policy"`
+	TokenNumUses         int      `json:"token_num_uses" yaml:"token_num_uses"`
+	TokenPeriod          duration `json:"token_period" yaml:"token_period"`
+	TokenPolicies        []string `json:"token_policies" yaml:"token_policies"`
+	TokenTTL             duration `json:"token_ttl" yaml:"token_ttl"`
+	TokenType            string   `json:"token_type" yaml:"token_type"`
+}
+
+// setDefaults sets the token fields that aren't configured to Vault's
+// defaults, so removing a field from the configuration resets it
+func (t *authTokenFields) setDefaults() {
+	if t.TokenType == "" {
+		t.TokenType = "default"
+	}
+}
+
+// authRoleFile is a role configured in its own file
+type authRoleFile struct {
+	Name    string
+	Path    string
+	Content []byte
+}
+
+// getAuthMethodRoleFiles reads in the roles configured one per file in
+// auth_methods/<name>/roles/. Roles are named by their filename
+func getAuthMethodRoleFiles(name string) []authRoleFile {
+	rolesPath := path.Join(Spec.ConfigurationPath, "auth_methods", name, "roles")
+	entries, skipped, err := walkConfigDirectory(rolesPath, isConfigFile, false)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading roles [%s]: %v", rolesPath, err)
+	}
+	for _, filePath := range skipped {
+		log.Warnf("Configuration file [%s] does not have a valid extension and will not be processed", filePath)
+	}
+
+	var roleFiles []authRoleFile
+	for _, entry := range entries {
+		content, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		roleFiles = append(roleFiles, authRoleFile{Name: entry.Name, Path: entry.Path, Content: content})
+	}
+
+	return roleFiles
+}
+
+// authRoles are the roles of an auth method, configured in
+// additional_config.roles and one per file in auth_methods/<name>/roles/. Each
+// role is written to <Path>/role/<name> and roles in Vault that aren't
+// configured are prompted for deletion
+type authRoles struct {
+	// Description of a role, i.e. "AppRole role"
+	Description string
+
+	// Path to the auth backend (i.e. auth/approle)
+	Path string
+
+	// Name of the auth method's configuration
+	Name string
+
+	// Kind of templates the roles can extend and the schema unknown role
+	// fields are reported against, if the auth method supports them
+	TemplateKind string
+	SchemaName   string
+
+	configuredRoleList SecretList
+}
+
+// load reads in the roles from additional_config.roles and the roles
+// directory (named by their filename) into roles, which must be a pointer to
+// a slice of the auth method's role type
+func (r *authRoles) load(additionalConfig interface{}, roles interface{}) {
+	var config struct {
+		Roles []interface{} `json:"roles"`
+	}
+	unmarshalAdditionalConfig(r.Path, additionalConfig, &config)
+
+	if r.TemplateKind != "" {
+		resolved, err := applyExtendsToList(r.TemplateKind, config.Roles)
+		if err != nil {
+			log.Fatalf("Error applying templates to additional_config.roles for [%s]: %v", r.Path, err)
+		}
+		config.Roles = resolved.([]interface{})
+	}
+
+	list := reflect.ValueOf(roles).Elem()
+	roleNames := SecretList{}
+
+	// add parses a role and adds it to the list
+	add := func(content []byte, name string, description string) {
+		if r.SchemaName != "" {
+			var raw interface{}
+			if json.Unmarshal(content, &raw) == nil {
+				warnUnknownFields(raw, r.SchemaName, description)
+			}
+		}
+
+		role := reflect.New(list.Type().Elem())
+		if err := json.Unmarshal(content, role.Interface()); err != nil {
+			log.Fatalf("Error parsing %s: %v", description, err)
+		}
+		role.Elem().FieldByName("Name").SetString(name)
+
+		if roleNames.Contains(name) {
+			log.Fatalf("%s [%s] on auth method [%s] is configured more than once", r.Description, name, r.Path)
+		}
+		roleNames.Add(name)
+		list.Set(reflect.Append(list, role.Elem()))
+	}
+
+	for i, role := range config.Roles {
+		m, _ := role.(map[string]interface{})
+		name, _ := m["name"].(string)
+		if name == "" {
+			log.Fatalf("Error parsing additional_config.roles[%d] on auth method [%s]. Missing 'name' field.", i, r.Path)
+		}
+
+		content, err := json.Marshal(role)
+		if err != nil {
+			log.Fatalf("Unable to marshall additional_config for [%s]: %v", r.Path, err)
+		}
+		add(content, name, fmt.Sprintf("%s additional_config.roles[%d] on auth method [%s]", r.Description, i, r.Path))
+	}
+
+	for _, roleFile := range getAuthMethodRoleFiles(r.Name) {
+		content := roleFile.Content
+		if r.TemplateKind != "" {
+			var err error
+			if content, err = applyExtends(r.TemplateKind, content); err != nil {
+				log.Fatalf("Error applying templates to %s [%s]: %v", r.Description, roleFile.Path, err)
+			}
+		}
+
+		// Use the filename (and any subdirectories) as the role name
+		add(content, roleFile.Name, fmt.Sprintf("%s [%s]", r.Description, roleFile.Path))
+	}
+}
+
+// write queues the write of a role's configuration. deferred, if set, is run
+// once the role has been written (i.e. for settings that need the role to exist)
+func (r *authRoles) write(name string, data map[string]interface{}, deferred func()) {
+	rolePath := path.Join(r.Path, "role", name)
+	delete(data, "name")
+
+	task := taskWrite{
+		Path:        rolePath,
+		Description: fmt.Sprintf("%s [%s]", r.Description, rolePath),
+		Data:        data,
+		Defer:       deferred,
+	}
+	wg.Add(1)
+	taskChan <- task
+	r.configuredRoleList.Add(name)
+}
+
+func (r *authRoles) Cleanup() {
+
+	// There is no "key_info" for listing roles so we just use a regular list
+	existingRoles := getSecretList(path.Join(r.Path, "role"))
+
+	for _, roleName := range existingRoles {
+		rolePath := path.Join(r.Path, "role", roleName)
+		if r.configuredRoleList.Contains(roleName) {
+			log.Debugf("%s [%s] exists in configuration, no cleanup necessary", r.Description, rolePath)
+		} else {
+			task := taskDelete{
+				Description: fmt.Sprintf("%s [%s]", r.Description, rolePath),
+				Path:        rolePath,
+			}
+			taskPromptChan <- task
+		}
+	}
+}
+
+// authMapping is a set of named items of an auth method (i.e. GitHub teams or
+// Okta users) that map to policies. Each item is written to <Path>/<name> and
+// items in Vault that aren't configured are prompted for deletion
+type authMapping struct {
+	// Description of an item, i.e. "GitHub team"
+	Description string
+	Path        string
+	Items       map[string]map[string]interface{}
+}
+
+func (mapping authMapping) Configure() {
+	for name, data := range mapping.Items {
+		itemPath := path.Join(mapping.Path, name)
+		task := taskWrite{
+			Path:        itemPath,
+			Description: fmt.Sprintf("%s mapping [%s]", mapping.Description, itemPath),
+			Data:        data,
+		}
+		wg.Add(1)
+		taskChan <- task
+	}
+
+	mapping.Cleanup()
+}
+
+func (mapping authMapping) Cleanup() {
+	for _, name := range getSecretList(mapping.Path) {
+		itemPath := path.Join(mapping.Path, name)
+		if _, ok := mapping.Items[name]; ok {
+			log.Debugf("%s mapping [%s] exists in configuration, no cleanup necessary", mapping.Description, itemPath)
+		} else {
+			task := taskDelete{
+				Description: fmt.Sprintf("%s mapping [%s]", mapping.Description, itemPath),
+				Path:        itemPath,
+			}
+			taskPromptChan <- task
+		}
+	}
+}
+
+// unmarshalAdditionalConfig converts an auth method's additional_config into
+// its typed configuration
+func unmarshalAdditionalConfig(authPath string, additionalConfig interface{}, config interface{}) {
+
+	// Marshall and unmarshall back into our struct
+	jsonData, err := json.Marshal(&additionalConfig)
+	if err != nil {
+		log.Fatalf("Unable to marshall additional_config for [%s]: %v", authPath, err)
+	}
+
+	err = json.Unmarshal(jsonData, config)
+	if err != nil {
+		log.Fatalf("Unable to unmarshall additional_config for [%s]: %v", authPath, err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type AuthMethodAppRole struct {
+	// Path to the auth backend (i.e. /auth/approle)
+	Path string
+
+	// Name of the auth method's configuration, roles can also be configured in
+	// auth_methods/<name>/roles/
+	Name string
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+}
+
+type AuthMethodAppRoleAdditionalConfig struct {
+	Roles []appRole `json:"roles" yaml:"roles"`
+}
+
+// See https://www.vaultproject.io/api/auth/approle/index.html#create-update-approle
+// TTLs can be given as a number of seconds or a duration string (i.e. "1h")
+type appRole struct {
+	Name string `json:"name" yaml:"name"`
+
+	// If set, the role_id is pinned to this value rather than the one
+	// generated by Vault
+	RoleID string `json:"role_id" yaml:"role_id"`
+
+	// Require a secret_id to log in (defaults to true)
+	BindSecretID *bool `json:"bind_secret_id" yaml:"bind_secret_id"`
+
+	// The set of CIDRs that secret_ids can be used from
+	SecretIDBoundCIDRs []string `json:"secret_id_bound_cidrs" yaml:"secret_id_bound_cidrs"`
+
+	// The number of times a secret_id can be used to log in (0 is unlimited)
+	SecretIDNumUses int `json:"secret_id_num_uses" yaml:"secret_id_num_uses"`
+
+	SecretIDTTL interface{} `json:"secret_id_ttl" yaml:"secret_id_ttl"`
+
+	authTokenFields
+}
+
+func (auth *AuthMethodAppRole) Configure() {
+
+	roles := auth.roles()
+	for _, role := range auth.getRoles() {
+		auth.setRoleDefaults(&role)
+
+		data := structToMap(role)
+		delete(data, "role_id")
+
+		// The role_id can only be set once the role exists
+		var deferred func()
+		if role.RoleID != "" {
+			rolePath := path.Join(auth.Path, "role", role.Name)
+			roleIDTask := taskWrite{
+				Path:        path.Join(rolePath, "role-id"),
+				Description: fmt.Sprintf("AppRole role_id for [%s]", rolePath),
+				Data:        map[string]interface{}{"role_id": role.RoleID},
+			}
+			deferred = func() {
+				wg.Add(1)
+				taskChan <- roleIDTask
+			}
+		}
+
+		roles.write(role.Name, data, deferred)
+	}
+
+	roles.Cleanup()
+}
+
+func (auth *AuthMethodAppRole) roles() *authRoles {
+	return &authRoles{Description: "AppRole role", Path: auth.Path, Name: auth.Name}
+}
+
+// getRoles reads in the roles from additional_config.roles and the roles
+// directory (named by their filename)
+func (auth *AuthMethodAppRole) getRoles() []appRole {
+	var roles []appRole
+	auth.roles().load(auth.AdditionalConfig, &roles)
+	return roles
+}
+
+func (auth *AuthMethodAppRole) setRoleDefaults(role *appRole) {
+	if role.BindSecretID == nil {
+		bindSecretID := true
+		role.BindSecretID = &bindSecretID
+	}
+	if role.SecretIDTTL == nil {
+		role.SecretIDTTL = 0
+	}
+	role.authTokenFields.setDefaults()
+}
+
+// appRoleSecretID is written out by IssueAppRoleSecretIDs for each role
+type appRoleSecretID struct {
+	RoleID           string `json:"role_id"`
+	WrappingToken    string `json:"wrapping_token"`
+	WrappingAccessor string `json:"wrapping_accessor"`
+	WrapTTL          int    `json:"wrap_ttl"`
+	CreationTime     string `json:"creation_time"`
+}
+
+// IssueAppRoleSecretIDs issues a new response wrapped secret_id for every
+// AppRole role in the configuration. Each is written, with the role's
+// role_id, to <output>/<auth method>/<role>.json
+func IssueAppRoleSecretIDs() {
+	if Spec.Output == "" {
+		log.Fatal("An output directory (--output) is required to write the secret_ids to")
+	}
+
+	// Only the secret_id requests are response wrapped
+	VaultClient.SetWrappingLookupFunc(func(operation, requestPath string) string {
+		if strings.HasSuffix(requestPath, "/secret-id") {
+			return Spec.WrapTTL
+		}
+		return ""
+	})
+
+	authMethodList := authMethodList{}
+	getAuthMethods(authMethodList)
+
+	for _, mount := range authMethodList {
+		if mount.AuthOptions.Type != "approle" {
+			continue
+		}
+
+		auth := AuthMethodAppRole{
+			Path:             path.Join("auth", mount.Path),
+			Name:             mount.Name,
+			AdditionalConfig: mount.AdditionalConfig,
+		}
+
+		for _, role := range auth.getRoles() {
+			rolePath := path.Join(auth.Path, "role", role.Name)
+
+			roleID, err := Vault.Read(path.Join(rolePath, "role-id"))
+			if err != nil || roleID == nil {
+				log.Fatalf("Error reading role_id for AppRole role [%s]: %v", rolePath, err)
+			}
+
+			secret, err := Vault.Write(path.Join(rolePath, "secret-id"), nil)
+			if err != nil {
+				log.Fatalf("Error issuing secret_id for AppRole role [%s]: %v", rolePath, err)
+			}
+			if secret == nil || secret.WrapInfo == nil {
+				log.Fatalf("secret_id for AppRole role [%s] was not response wrapped", rolePath)
+			}
+			registerSecretValue(secret.WrapInfo.Token)
+
+			secretID := appRoleSecretID{
+				RoleID:           fmt.Sprintf("%v", roleID.Data["role_id"]),
+				WrappingToken:    secret.WrapInfo.Token,
+				WrappingAccessor: secret.WrapInfo.Accessor,
+				WrapTTL:          secret.WrapInfo.TTL,
+				CreationTime:     secret.WrapInfo.CreationTime.Format(time.RFC3339),
+			}
+			content, err := json.MarshalIndent(secretID, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			filePath := path.Join(Spec.Output, mount.Name, role.Name+".json")
+			if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+				log.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filePath, append(content, '\n'), 0600); err != nil {
+				log.Fatalf("Error writing secret_id for AppRole role [%s]: %v", rolePath, err)
+			}
+
+			log.Infof("Wrapped secret_id for AppRole role [%s] written to [%s]", rolePath, filePath)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppRoleConfigure(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/approle/roles/team/app.yaml": "role_id: app-role-id\ntoken_policies: [app]\ntoken_ttl: 1h\n",
+	})
+	vault := newTestVault(t)
+	vault.Lists["auth/approle/role"] = []string{"ci", "old", "team-app"}
+	setSpec(t, &Spec.NameSeparator, "-")
+	collect := captureTasks(t)
+
+	auth := AuthMethodAppRole{
+		Path:             "auth/approle",
+		Name:             "approle",
+		AdditionalConfig: map[string]interface{}{"roles": []interface{}{map[string]interface{}{"name": "ci", "bind_secret_id": false, "secret_id_ttl": "10m"}}},
+	}
+	auth.Configure()
+	tasks := collect()
+
+	want := map[string]map[string]interface{}{
+		"auth/approle/role/ci": {
+			"bind_secret_id": false, "secret_id_bound_cidrs": nil, "secret_id_num_uses": float64(0), "secret_id_ttl": "10m",
+			"token_bound_cidrs": nil, "token_explicit_max_ttl": float64(0), "token_max_ttl": float64(0), "token_no_default_policy": false,
+			"token_num_uses": float64(0), "token_period": float64(0), "token_policies": nil, "token_ttl": float64(0), "token_type": "default",
+		},
+		"auth/approle/role/team-app": {
+			"bind_secret_id": true, "secret_id_bound_cidrs": nil, "secret_id_num_uses": float64(0), "secret_id_ttl": float64(0),
+			"token_bound_cidrs": nil, "token_explicit_max_ttl": float64(0), "token_max_ttl": float64(0), "token_no_default_policy": false,
+			"token_num_uses": float64(0), "token_period": float64(0), "token_policies": []interface{}{"app"}, "token_ttl": float64(3600), "token_type": "default",
+		},
+	}
+	if len(tasks.writes) != len(want) {
+		t.Errorf("Configure() wrote %d roles, want %d", len(tasks.writes), len(want))
+	}
+	for rolePath, data := range want {
+		if got := tasks.writes[rolePath].Data; !reflect.DeepEqual(got, data) {
+			t.Errorf("Configure() wrote %s = %v, want %v", rolePath, got, data)
+		}
+	}
+	if !reflect.DeepEqual(tasks.deletes, []string{"auth/approle/role/old"}) {
+		t.Errorf("Configure() prompted to delete %v, want [auth/approle/role/old]", tasks.deletes)
+	}
+
+	// The role_id is written once the role has been
+	if tasks.writes["auth/approle/role/ci"].Defer != nil {
+		t.Error("Configure() set the role_id of a role without one")
+	}
+	tasks.writes["auth/approle/role/team-app"].Defer()
+	roleID := collect().writes["auth/approle/role/team-app/role-id"].Data
+	if !reflect.DeepEqual(roleID, map[string]interface{}{"role_id": "app-role-id"}) {
+		t.Errorf("Configure() wrote role_id %v, want app-role-id", roleID)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"path"
+)
+
+type AuthMethodAWS struct {
+	// Path to the auth backend (i.e. /auth/aws)
+	Path string
+
+	// Name of the auth method's configuration, roles can also be configured in
+	// auth_methods/<name>/roles/
+	Name string
+
+	// Config is the client configuration, written to config/client
+	Config map[string]interface{}
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+
+	configuredSTSList SecretList
+}
+
+type AuthMethodAWSAdditionalConfig struct {
+	Roles []awsAuthRole `json:"roles" yaml:"roles"`
+
+	// Roles to assume when authenticating clients from other AWS accounts
+	STS []awsAuthSTSRole `json:"sts" yaml:"sts"`
+
+	// Tidy settings for the identity whitelist and role tag blacklist
+	IdentityWhitelist *awsAuthTidy `json:"identity_whitelist" yaml:"identity_whitelist"`
+	RoletagBlacklist  *awsAuthTidy `json:"roletag_blacklist" yaml:"roletag_blacklist"`
+}
+
+// See https://www.vaultproject.io/api/auth/aws/index.html#create-sts-role
+type awsAuthSTSRole struct {
+	AccountID string `json:"account_id" yaml:"account_id"`
+	STSRole   string `json:"sts_role" yaml:"sts_role"`
+}
+
+// See https://www.vaultproject.io/api/auth/aws/index.html#configure-identity-whitelist-tidy-operation
+type awsAuthTidy struct {
+	SafetyBuffer        interface{} `json:"safety_buffer" yaml:"safety_buffer"`
+	DisablePeriodicTidy bool        `json:"disable_periodic_tidy" yaml:"disable_periodic_tidy"`
+}
+
+// See https://www.vaultproject.io/api/auth/aws/index.html#create-role
+type awsAuthRole struct {
+	Name string `json:"name" yaml:"name"`
+
+	// ec2 or iam (the default)
+	AuthType string `json:"auth_type" yaml:"auth_type"`
+
+	// Bindings for both auth types
+	BoundAccountID []string `json:"bound_account_id" yaml:"bound_account_id"`
+
+	// Bindings for the ec2 auth type, or the iam auth type with an inferred entity type
+	BoundAMIID                 []string `json:"bound_ami_id" yaml:"bound_ami_id"`
+	BoundRegion                []string `json:"bound_region" yaml:"bound_region"`
+	BoundVPCID                 []string `json:"bound_vpc_id" yaml:"bound_vpc_id"`
+	BoundSubnetID              []string `json:"bound_subnet_id" yaml:"bound_subnet_id"`
+	BoundIAMRoleARN            []string `json:"bound_iam_role_arn" yaml:"bound_iam_role_arn"`
+	BoundIAMInstanceProfileARN []string `json:"bound_iam_instance_profile_arn" yaml:"bound_iam_instance_profile_arn"`
+	BoundEC2InstanceID         []string `json:"bound_ec2_instance_id" yaml:"bound_ec2_instance_id"`
+	RoleTag                    string   `json:"role_tag" yaml:"role_tag"`
+	AllowInstanceMigration     bool     `json:"allow_instance_migration" yaml:"allow_instance_migration"`
+	DisallowReauthentication   bool     `json:"disallow_reauthentication" yaml:"disallow_reauthentication"`
+
+	// Bindings for the iam auth type
+	BoundIAMPrincipalARN []string `json:"bound_iam_principal_arn" yaml:"bound_iam_principal_arn"`
+	InferredEntityType   string   `json:"inferred_entity_type" yaml:"inferred_entity_type"`
+	InferredAWSRegion    string   `json:"inferred_aws_region" yaml:"inferred_aws_region"`
+
+	// Can only be set when the role is created
+	ResolveAWSUniqueIDs *bool `json:"resolve_aws_unique_ids,omitempty" yaml:"resolve_aws_unique_ids"`
+
+	authTokenFields
+}
+
+func (auth *AuthMethodAWS) Configure() {
+
+	config := auth.getAdditionalConfig()
+
+	for _, sts := range config.STS {
+		stsPath := path.Join(auth.Path, "config/sts", sts.AccountID)
+		task := taskWrite{
+			Path:        stsPath,
+			Description: fmt.Sprintf("AWS auth STS role [%s]", stsPath),
+			Data:        map[string]interface{}{"sts_role": sts.STSRole},
+		}
+		wg.Add(1)
+		taskChan <- task
+		auth.configuredSTSList = append(auth.configuredSTSList, sts.AccountID)
+	}
+
+	tidySettings := map[string]*awsAuthTidy{"identity-whitelist": config.IdentityWhitelist, "roletag-blacklist": config.RoletagBlacklist}
+	for name, tidy := range tidySettings {
+		tidyPath := path.Join(auth.Path, "config/tidy", name)
+		if tidy == nil {
+			auth.cleanupConfig(tidyPath, fmt.Sprintf("AWS auth tidy settings [%s]", tidyPath))
+			continue
+		}
+
+		if tidy.SafetyBuffer == nil {
+			tidy.SafetyBuffer = "72h"
+		}
+		task := taskWrite{
+			Path:        tidyPath,
+			Description: fmt.Sprintf("AWS auth tidy settings [%s]", tidyPath),
+			Data:        structToMap(tidy),
+		}
+		wg.Add(1)
+		taskChan <- task
+	}
+
+	// The client configuration itself is written with the auth method's config
+	if auth.Config == nil {
+		clientPath := path.Join(auth.Path, "config/client")
+		auth.cleanupConfig(clientPath, fmt.Sprintf("AWS auth client configuration [%s]", clientPath))
+	}
+
+	roles := auth.roles()
+	for _, role := range config.Roles {
+		auth.setRoleDefaults(&role)
+		roles.write(role.Name, structToMap(role), nil)
+	}
+
+	roles.Cleanup()
+	auth.Cleanup()
+}
+
+func (auth *AuthMethodAWS) roles() *authRoles {
+	return &authRoles{Description: "AWS auth role", Path: auth.Path, Name: auth.Name}
+}
+
+// getAdditionalConfig reads in the additional_config, including the roles
+// from the roles directory (named by their filename)
+func (auth *AuthMethodAWS) getAdditionalConfig() AuthMethodAWSAdditionalConfig {
+
+	var config AuthMethodAWSAdditionalConfig
+	unmarshalAdditionalConfig(auth.Path, auth.AdditionalConfig, &config)
+
+	for i, sts := range config.STS {
+		if sts.AccountID == "" || sts.STSRole == "" {
+			log.Fatalf("Error parsing additional_config.sts[%d] on auth method [%s]. Missing 'account_id' or 'sts_role' field.", i, auth.Path)
+		}
+	}
+
+	config.Roles = nil
+	auth.roles().load(auth.AdditionalConfig, &config.Roles)
+
+	return config
+}
+
+// cleanupConfig prompts for the deletion of a configuration endpoint (i.e.
+// the tidy settings) that isn't in the configuration, if it is set in Vault
+func (auth *AuthMethodAWS) cleanupConfig(configPath string, description string) {
+	existing, err := Vault.Read(configPath)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", description, err)
+	}
+	if existing == nil {
+		return
+	}
+
+	task := taskDelete{
+		Description: description,
+		Path:        configPath,
+	}
+	taskPromptChan <- task
+}
+
+func (auth *AuthMethodAWS) Cleanup() {
+
+	existingSTS := getSecretList(path.Join(auth.Path, "config/sts"))
+
+	for _, accountID := range existingSTS {
+		stsPath := path.Join(auth.Path, "config/sts", accountID)
+		if auth.configuredSTSList.Contains(accountID) {
+			log.Debugf("AWS auth STS role [%s] exists in configuration, no cleanup necessary", stsPath)
+		} else {
+			task := taskDelete{
+				Description: fmt.Sprintf("AWS auth STS role [%s]", stsPath),
+				Path:        stsPath,
+			}
+			taskPromptChan <- task
+		}
+	}
+}
+
+func (auth *AuthMethodAWS) setRoleDefaults(role *awsAuthRole) {
+	if role.AuthType == "" {
+		role.AuthType = "iam"
+	}
+
+	// Unset bindings are sent as empty lists so removing them from the
+	// configuration clears them
+	bindings := []*[]string{&role.BoundAccountID, &role.BoundAMIID, &role.BoundRegion, &role.BoundVPCID, &role.BoundSubnetID, &role.BoundIAMRoleARN, &role.BoundIAMInstanceProfileARN, &role.BoundEC2InstanceID, &role.BoundIAMPrincipalARN}
+	for _, binding := range bindings {
+		if *binding == nil {
+			*binding = []string{}
+		}
+	}
+
+	role.authTokenFields.setDefaults()
+}
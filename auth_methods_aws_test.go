@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAWSConfigure(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/aws/roles/ec2.yaml": "auth_type: ec2\nbound_ami_id: [ami-1234]\nbound_region: [us-east-1]\n",
+	})
+	vault := newTestVault(t)
+	vault.Data["auth/aws/config/client"] = map[string]interface{}{"access_key": "AKIA"}
+	vault.Data["auth/aws/config/tidy/roletag-blacklist"] = map[string]interface{}{"safety_buffer": 259200}
+	vault.Lists["auth/aws/config/sts"] = []string{"111111111111", "222222222222"}
+	vault.Lists["auth/aws/role"] = []string{"ec2", "old"}
+	collect := captureTasks(t)
+
+	auth := AuthMethodAWS{
+		Path: "auth/aws",
+		Name: "aws",
+		AdditionalConfig: map[string]interface{}{
+			"sts":                []interface{}{map[string]interface{}{"account_id": "111111111111", "sts_role": "arn:aws:iam::111111111111:role/vault"}},
+			"identity_whitelist": map[string]interface{}{"disable_periodic_tidy": true},
+			"roles":              []interface{}{map[string]interface{}{"name": "app", "bound_iam_principal_arn": []interface{}{"arn:aws:iam::111111111111:role/app"}}},
+		},
+	}
+	auth.Configure()
+	tasks := collect()
+
+	want := map[string]map[string]interface{}{
+		"auth/aws/config/sts/111111111111":        {"sts_role": "arn:aws:iam::111111111111:role/vault"},
+		"auth/aws/config/tidy/identity-whitelist": {"safety_buffer": "72h", "disable_periodic_tidy": true},
+		"auth/aws/role/app":                       nil,
+		"auth/aws/role/ec2":                       nil,
+	}
+	if len(tasks.writes) != len(want) {
+		t.Errorf("Configure() wrote %d items, want %d", len(tasks.writes), len(want))
+	}
+	for itemPath, data := range want {
+		write, ok := tasks.writes[itemPath]
+		if !ok {
+			t.Errorf("Configure() did not write %s", itemPath)
+		} else if data != nil && !reflect.DeepEqual(write.Data, data) {
+			t.Errorf("Configure() wrote %s = %v, want %v", itemPath, write.Data, data)
+		}
+	}
+
+	// Unset bindings are cleared
+	bindings := map[string]map[string]interface{}{
+		"auth/aws/role/app": {"auth_type": "iam", "bound_iam_principal_arn": []interface{}{"arn:aws:iam::111111111111:role/app"}, "bound_ami_id": []interface{}{}},
+		"auth/aws/role/ec2": {"auth_type": "ec2", "bound_ami_id": []interface{}{"ami-1234"}, "bound_iam_principal_arn": []interface{}{}, "bound_account_id": []interface{}{}},
+	}
+	for rolePath, fields := range bindings {
+		for k, v := range fields {
+			if got := tasks.writes[rolePath].Data[k]; !reflect.DeepEqual(got, v) {
+				t.Errorf("Configure() wrote %s %s = %#v, want %#v", rolePath, k, got, v)
+			}
+		}
+	}
+
+	wantDeletes := []string{"auth/aws/config/client", "auth/aws/config/sts/222222222222", "auth/aws/config/tidy/roletag-blacklist", "auth/aws/role/old"}
+	if !reflect.DeepEqual(tasks.deletes, wantDeletes) {
+		t.Errorf("Configure() prompted to delete %v, want %v", tasks.deletes, wantDeletes)
+	}
+}
+
+func TestAWSConfigureKeepsClientConfig(t *testing.T) {
+	writeConfigDir(t, nil)
+	vault := newTestVault(t)
+	vault.Data["auth/aws/config/client"] = map[string]interface{}{"access_key": "AKIA"}
+	collect := captureTasks(t)
+
+	auth := AuthMethodAWS{Path: "auth/aws", Name: "aws", Config: map[string]interface{}{"access_key": "AKIA"}}
+	auth.Configure()
+
+	if deletes := collect().deletes; len(deletes) > 0 {
+		t.Errorf("Configure() prompted to delete %v", deletes)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// Extensions of the PEM encoded CA certificates in auth_methods/<name>/certs/
+var certificateFileExtensions = []string{".pem", ".crt"}
+
+type AuthMethodCert struct {
+	// Path to the auth backend (i.e. /auth/cert)
+	Path string
+
+	// Name of the auth method's configuration, certificates are configured in
+	// auth_methods/<name>/certs/
+	Name string
+
+	configuredCertList SecretList
+}
+
+// See https://www.vaultproject.io/api/auth/cert/index.html#create-ca-certificate-role
+// The certificate is read from <name>.pem, the rest from the optional
+// <name>.yaml (or .json) next to it
+type certRole struct {
+	Certificate string `json:"certificate" yaml:"certificate"`
+
+	DisplayName string `json:"display_name" yaml:"display_name"`
+
+	// Constraints on the client certificates that can log in with the role
+	AllowedNames               []string `json:"allowed_names" yaml:"allowed_names"`
+	AllowedCommonNames         []string `json:"allowed_common_names" yaml:"allowed_common_names"`
+	AllowedDNSSANs             []string `json:"allowed_dns_sans" yaml:"allowed_dns_sans"`
+	AllowedEmailSANs           []string `json:"allowed_email_sans" yaml:"allowed_email_sans"`
+	AllowedURISANs             []string `json:"allowed_uri_sans" yaml:"allowed_uri_sans"`
+	AllowedOrganizationalUnits []string `json:"allowed_organizational_units" yaml:"allowed_organizational_units"`
+	RequiredExtensions         []string `json:"required_extensions" yaml:"required_extensions"`
+
+	authTokenFields
+}
+
+// authCertFile is a certificate configured in auth_methods/<name>/certs/
+type authCertFile struct {
+	Name string
+
+	CertificatePath string
+	Certificate     []byte
+
+	// Metadata is optional, MetadataPath is empty if there isn't any
+	MetadataPath string
+	Metadata     []byte
+}
+
+func (auth *AuthMethodCert) Configure() {
+
+	for _, certFile := range getAuthMethodCertFiles(auth.Name) {
+		var cert certRole
+		if certFile.MetadataPath != "" {
+			if err := json.Unmarshal(certFile.Metadata, &cert); err != nil {
+				log.Fatal("Error parsing certificate configuration: ", certFile.MetadataPath, " ", err)
+			}
+			if cert.Certificate != "" {
+				log.Fatalf("Certificate configuration [%s] can't set the certificate, it is read from [%s]", certFile.MetadataPath, certFile.CertificatePath)
+			}
+		}
+
+		cert.Certificate = string(certFile.Certificate)
+		if cert.DisplayName == "" {
+			cert.DisplayName = certFile.Name
+		}
+		cert.authTokenFields.setDefaults()
+
+		certPath := path.Join(auth.Path, "certs", certFile.Name)
+		task := taskWrite{
+			Path:        certPath,
+			Description: fmt.Sprintf("Certificate role [%s]", certPath),
+			Data:        structToMap(cert),
+		}
+		wg.Add(1)
+		taskChan <- task
+		auth.configuredCertList = append(auth.configuredCertList, certFile.Name)
+	}
+
+	auth.Cleanup()
+}
+
+func (auth *AuthMethodCert) Cleanup() {
+
+	existingCerts := getSecretList(path.Join(auth.Path, "certs"))
+
+	for _, certName := range existingCerts {
+		certPath := path.Join(auth.Path, "certs", certName)
+		if auth.configuredCertList.Contains(certName) {
+			log.Debugf("Certificate role [%s] exists in configuration, no cleanup necessary", certPath)
+		} else {
+			task := taskDelete{
+				Description: fmt.Sprintf("Certificate role [%s]", certPath),
+				Path:        certPath,
+			}
+			taskPromptChan <- task
+		}
+	}
+}
+
+// getAuthMethodCertFiles reads in the certificates, and their metadata, in
+// auth_methods/<name>/certs/. Certificates are named by their filename.
+// The certificates are read as-is, without rendering templates
+func getAuthMethodCertFiles(name string) []authCertFile {
+	certsPath := path.Join(Spec.ConfigurationPath, "auth_methods", name, "certs")
+
+	certEntries, metadataEntries, skipped, err := walkCertDirectory(certsPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading certificates [%s]: %v", certsPath, err)
+	}
+	for _, filePath := range skipped {
+		log.Warnf("Configuration file [%s] does not have a valid extension and will not be processed", filePath)
+	}
+
+	certFiles := make(map[string]*authCertFile)
+	for _, entry := range certEntries {
+		certificate, err := ioutil.ReadFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := checkCertificatePEM(certificate); err != nil {
+			log.Fatalf("Invalid certificate [%s]: %v", entry.Path, err)
+		}
+		certFiles[entry.Name] = &authCertFile{Name: entry.Name, CertificatePath: entry.Path, Certificate: certificate}
+	}
+
+	for _, entry := range metadataEntries {
+		certFile, ok := certFiles[entry.Name]
+		if !ok {
+			log.Fatalf("Certificate configuration [%s] has no certificate file (%s) next to it", entry.Path, certificateFileExtensions[0])
+		}
+		content, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		certFile.MetadataPath = entry.Path
+		certFile.Metadata = content
+	}
+
+	var names []string
+	for certName := range certFiles {
+		names = append(names, certName)
+	}
+	sort.Strings(names)
+
+	var result []authCertFile
+	for _, certName := range names {
+		result = append(result, *certFiles[certName])
+	}
+
+	return result
+}
+
+// walkCertDirectory finds the certificates and their metadata files in a
+// certs directory. Each is walked separately as a certificate and its
+// metadata share a name. Files that are neither are returned separately
+func walkCertDirectory(dirPath string) ([]configEntry, []configEntry, []string, error) {
+	certEntries, skippedCerts, err := walkConfigDirectory(dirPath, isCertificateFile, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	metadataEntries, _, err := walkConfigDirectory(dirPath, isConfigFile, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var skipped []string
+	for _, filePath := range skippedCerts {
+		if !isConfigFile(filePath) {
+			skipped = append(skipped, filePath)
+		}
+	}
+
+	return certEntries, metadataEntries, skipped, nil
+}
+
+// checkCertificatePEM checks that content is one or more PEM encoded
+// certificates
+func checkCertificatePEM(content []byte) error {
+	count := 0
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("unexpected PEM block [%s]", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count == 0 {
+		return fmt.Errorf("no PEM encoded certificates found")
+	}
+	if len(bytes.TrimSpace(content)) > 0 {
+		return fmt.Errorf("unexpected content after the last certificate")
+	}
+	return nil
+}
+
+func isCertificateFile(filename string) bool {
+	for _, ext := range certificateFileExtensions {
+		if checkExt(filename, ext) {
+			return true
+		}
+	}
+
+	return false
+}
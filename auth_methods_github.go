@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+type AuthMethodGitHub struct {
+	// Path to the auth backend (i.e. /auth/github)
+	Path string
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+}
+
+// Policies for GitHub teams (by slug) and users, see
+// https://www.vaultproject.io/api/auth/github/index.html#map-github-teams
+type AuthMethodGitHubAdditionalConfig struct {
+	Teams map[string][]string `json:"teams" yaml:"teams"`
+	Users map[string][]string `json:"users" yaml:"users"`
+}
+
+func (auth *AuthMethodGitHub) Configure() {
+
+	var config AuthMethodGitHubAdditionalConfig
+	unmarshalAdditionalConfig(auth.Path, auth.AdditionalConfig, &config)
+
+	teams := authMapping{Description: "GitHub team", Path: path.Join(auth.Path, "map/teams"), Items: githubPolicyMap(config.Teams)}
+	users := authMapping{Description: "GitHub user", Path: path.Join(auth.Path, "map/users"), Items: githubPolicyMap(config.Users)}
+	teams.Configure()
+	users.Configure()
+}
+
+// githubPolicyMap converts a map of names to policies to the comma separated
+// "value" GitHub mappings take. Names are lowered because that's how Vault
+// stores them
+func githubPolicyMap(policyMap map[string][]string) map[string]map[string]interface{} {
+	items := make(map[string]map[string]interface{})
+	for name, policies := range policyMap {
+		items[strings.ToLower(name)] = map[string]interface{}{"value": strings.Join(policies, ",")}
+	}
+	return items
+}
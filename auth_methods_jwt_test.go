@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJWTConfigure(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/oidc/roles/cli.yaml": "extends: base\nrole_type: jwt\ncallback_mode: device\nclock_skew_leeway: -1\n",
+		"templates/jwt-roles/base.yaml":    "user_claim: email\ntoken_policies: [base]\ntoken_ttl: 1h\n",
+	})
+	vault := newTestVault(t)
+	vault.Lists["auth/oidc/role"] = []string{"cli", "old"}
+	collect := captureTasks(t)
+
+	auth := AuthMethodJWT{
+		Path: "auth/oidc",
+		Name: "oidc",
+		AdditionalConfig: map[string]interface{}{"roles": []interface{}{
+			map[string]interface{}{"name": "web", "extends": "base", "bound_claims_type": "glob", "max_age": "10m"},
+		}},
+	}
+	auth.Configure()
+	tasks := collect()
+
+	// Unset fields are sent too, so removing them from the configuration
+	// resets them to their defaults
+	want := map[string]map[string]interface{}{
+		"auth/oidc/role/web": {
+			"user_claim": "email", "token_policies": []interface{}{"base"}, "token_ttl": float64(3600), "max_age": float64(600),
+			"role_type": "oidc", "bound_claims_type": "glob", "callback_mode": "client", "clock_skew_leeway": float64(0), "token_type": "default",
+		},
+		"auth/oidc/role/cli": {
+			"user_claim": "email", "token_policies": []interface{}{"base"}, "token_ttl": float64(3600), "max_age": float64(0),
+			"role_type": "jwt", "bound_claims_type": "string", "callback_mode": "device", "clock_skew_leeway": float64(-1), "token_type": "default",
+		},
+	}
+	if len(tasks.writes) != len(want) {
+		t.Errorf("Configure() wrote %d roles, want %d", len(tasks.writes), len(want))
+	}
+	for rolePath, fields := range want {
+		data := tasks.writes[rolePath].Data
+		if _, ok := data["name"]; ok {
+			t.Errorf("Configure() wrote the name to %s", rolePath)
+		}
+		for k, v := range fields {
+			if got, ok := data[k]; !ok || !reflect.DeepEqual(got, v) {
+				t.Errorf("Configure() wrote %s %s = %v, want %v", rolePath, k, got, v)
+			}
+		}
+	}
+	if !reflect.DeepEqual(tasks.deletes, []string{"auth/oidc/role/old"}) {
+		t.Errorf("Configure() prompted to delete %v, want [auth/oidc/role/old]", tasks.deletes)
+	}
+}
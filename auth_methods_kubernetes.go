@@ -0,0 +1,65 @@
+package main
+
+type AuthMethodKubernetes struct {
+	// Path to the auth backend (i.e. /auth/kubernetes)
+	Path string
+
+	// Name of the auth method's configuration, roles can also be configured in
+	// auth_methods/<name>/roles/
+	Name string
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+}
+
+type AuthMethodKubernetesAdditionalConfig struct {
+	Roles []kubernetesRole `json:"roles" yaml:"roles"`
+}
+
+// See https://www.vaultproject.io/api/auth/kubernetes/index.html#create-role
+type kubernetesRole struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Service account names and namespaces able to access the role, "*" allows all
+	BoundServiceAccountNames      []string `json:"bound_service_account_names" yaml:"bound_service_account_names"`
+	BoundServiceAccountNamespaces []string `json:"bound_service_account_namespaces" yaml:"bound_service_account_namespaces"`
+
+	// Audience claim to verify in the service account JWT
+	Audience string `json:"audience" yaml:"audience"`
+
+	// Whether entity aliases are named by the service account's uid (the
+	// default) or name
+	AliasNameSource string `json:"alias_name_source" yaml:"alias_name_source"`
+
+	authTokenFields
+}
+
+func (auth *AuthMethodKubernetes) Configure() {
+
+	roles := auth.roles()
+	for _, role := range auth.getRoles() {
+		auth.setRoleDefaults(&role)
+		roles.write(role.Name, structToMap(role), nil)
+	}
+
+	roles.Cleanup()
+}
+
+func (auth *AuthMethodKubernetes) roles() *authRoles {
+	return &authRoles{Description: "Kubernetes role", Path: auth.Path, Name: auth.Name}
+}
+
+// getRoles reads in the roles from additional_config.roles and the roles
+// directory (named by their filename)
+func (auth *AuthMethodKubernetes) getRoles() []kubernetesRole {
+	var roles []kubernetesRole
+	auth.roles().load(auth.AdditionalConfig, &roles)
+	return roles
+}
+
+func (auth *AuthMethodKubernetes) setRoleDefaults(role *kubernetesRole) {
+	if role.AliasNameSource == "" {
+		role.AliasNameSource = "serviceaccount_uid"
+	}
+	role.authTokenFields.setDefaults()
+}
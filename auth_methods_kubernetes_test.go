@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKubernetesConfigure(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/kubernetes/roles/batch.yaml": "bound_service_account_names: [batch]\nbound_service_account_namespaces: [jobs]\naudience: vault\nalias_name_source: serviceaccount_name\n",
+	})
+	newTestVault(t)
+	collect := captureTasks(t)
+
+	auth := AuthMethodKubernetes{
+		Path:             "auth/kubernetes",
+		Name:             "kubernetes",
+		AdditionalConfig: map[string]interface{}{"roles": []interface{}{map[string]interface{}{"name": "app", "bound_service_account_names": []interface{}{"app"}, "token_ttl": 3600}}},
+	}
+	auth.Configure()
+	tasks := collect()
+
+	tokenDefaults := map[string]interface{}{
+		"token_bound_cidrs": nil, "token_explicit_max_ttl": float64(0), "token_max_ttl": float64(0), "token_no_default_policy": false,
+		"token_num_uses": float64(0), "token_period": float64(0), "token_policies": nil, "token_ttl": float64(0), "token_type": "default",
+	}
+	want := map[string]map[string]interface{}{
+		// Unset fields are sent so removing them from the configuration resets them
+		"auth/kubernetes/role/app": {
+			"bound_service_account_names": []interface{}{"app"}, "bound_service_account_namespaces": nil,
+			"audience": "", "alias_name_source": "serviceaccount_uid", "token_ttl": float64(3600),
+		},
+		"auth/kubernetes/role/batch": {
+			"bound_service_account_names": []interface{}{"batch"}, "bound_service_account_namespaces": []interface{}{"jobs"},
+			"audience": "vault", "alias_name_source": "serviceaccount_name",
+		},
+	}
+	if len(tasks.writes) != len(want) {
+		t.Errorf("Configure() wrote %d roles, want %d", len(tasks.writes), len(want))
+	}
+	for rolePath, data := range want {
+		for k, v := range tokenDefaults {
+			if _, ok := data[k]; !ok {
+				data[k] = v
+			}
+		}
+		if got := tasks.writes[rolePath].Data; !reflect.DeepEqual(got, data) {
+			t.Errorf("Configure() wrote %s = %v, want %v", rolePath, got, data)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"path"
+	"strings"
 )
 
 type LdapPolicyMap map[string]LdapPolicyItem
@@ -12,6 +13,15 @@ type LdapPolicyItem struct {
 	Policies []string
 }
 
+type LdapUserMap map[string]LdapUserItem
+
+// LdapUserItem is an LDAP user's policies and the groups it is in, on top of
+// the groups it's a member of in LDAP
+type LdapUserItem struct {
+	Policies []string `json:"policies"`
+	Groups   []string `json:"groups"`
+}
+
 // ConfigureLdapAuth creates/updates an LDAP auth method
 func configureLDAPAuth(auth authMethod) {
 
@@ -19,14 +29,48 @@ func configureLDAPAuth(auth authMethod) {
 	additionalConfig := auth.AdditionalConfig.(map[string]interface{})
 	policyMap := additionalConfig["policy_map"].(map[string]interface{})
 
+	// Vault stores group and user names in lower case unless they are case sensitive
+	caseSensitive := ldapCaseSensitiveNames(auth)
+
 	// Update polics->ldap_group config
 	ldapPolicyMap := LdapPolicyMap{}
-	getLdapPolicies(ldapPolicyMap, policyMap)
+	getLdapPolicies(ldapPolicyMap, policyMap, caseSensitive)
 	configureLdapPolicies(auth.Path, ldapPolicyMap)
 	cleanupLdapPolicies(auth.Path, ldapPolicyMap)
+
+	// Update policies/groups->ldap_user config. User mappings are only managed
+	// once one of the user maps is configured, otherwise they're left alone
+	if additionalConfig["user_policy_map"] == nil && additionalConfig["user_group_map"] == nil {
+		log.Debugf("No LDAP user mappings configured for [%s], skipping user mappings", auth.Path)
+		return
+	}
+	ldapUserMap := LdapUserMap{}
+	getLdapUsers(ldapUserMap, additionalConfig, caseSensitive)
+	configureLdapUsers(auth.Path, ldapUserMap)
+	cleanupLdapUsers(auth.Path, ldapUserMap)
+}
+
+// ldapCaseSensitiveNames returns whether the LDAP auth method is configured
+// with case_sensitive_names
+func ldapCaseSensitiveNames(auth authMethod) bool {
+	switch caseSensitive := auth.Config["case_sensitive_names"].(type) {
+	case bool:
+		return caseSensitive
+	case string:
+		return strings.ToLower(caseSensitive) == "true"
+	}
+	return false
+}
+
+// ldapName normalizes an LDAP group or user name the way Vault stores it
+func ldapName(name string, caseSensitive bool) string {
+	if caseSensitive {
+		return name
+	}
+	return strings.ToLower(name)
 }
 
-func getLdapPolicies(ldapPolicyMap LdapPolicyMap, policyMap map[string]interface{}) {
+func getLdapPolicies(ldapPolicyMap LdapPolicyMap, policyMap map[string]interface{}, caseSensitive bool) {
 
 	// Loop through the items and build the mapping list
 	for ldap_group, v := range policyMap {
@@ -45,7 +89,100 @@ func getLdapPolicies(ldapPolicyMap LdapPolicyMap, policyMap map[string]interface
 		default:
 			log.Fatal("Issue parsing LDAP policy map. Invalid value for key [" + ldap_group + "].  Should be an array of policy names. [error 001]")
 		}
-		ldapPolicyMap[ldap_group] = ldapPolicyItem
+		if _, ok := ldapPolicyMap[ldapName(ldap_group, caseSensitive)]; ok {
+			log.Fatal("Issue parsing LDAP policy map. Group [" + ldap_group + "] is configured more than once (names are not case sensitive)")
+		}
+		ldapPolicyMap[ldapName(ldap_group, caseSensitive)] = ldapPolicyItem
+	}
+}
+
+// getLdapUsers builds the LDAP user mappings from user_policy_map (user ->
+// policies) and user_group_map (user -> additional LDAP groups)
+func getLdapUsers(ldapUserMap LdapUserMap, additionalConfig map[string]interface{}, caseSensitive bool) {
+	for _, mapName := range []string{"user_policy_map", "user_group_map"} {
+		if additionalConfig[mapName] == nil {
+			continue
+		}
+		userMap, ok := additionalConfig[mapName].(map[string]interface{})
+		if !ok {
+			log.Fatalf("Issue parsing LDAP %s. Should be a map of user names", mapName)
+		}
+
+		// Names must be unique within each map once normalized
+		userNames := SecretList{}
+		for user, v := range userMap {
+			name := ldapName(user, caseSensitive)
+			if userNames.Contains(name) {
+				log.Fatalf("Issue parsing LDAP %s. User [%s] is configured more than once (names are not case sensitive)", mapName, user)
+			}
+			userNames.Add(name)
+
+			values, ok := ldapStringList(v)
+			if !ok {
+				log.Fatalf("Issue parsing LDAP %s. Invalid value for key [%s]. Should be an array of names", mapName, user)
+			}
+
+			// Both are always written so policies or groups removed from
+			// the configuration are removed in Vault
+			ldapUserItem, ok := ldapUserMap[name]
+			if !ok {
+				ldapUserItem = LdapUserItem{Policies: []string{}, Groups: []string{}}
+			}
+			if mapName == "user_policy_map" {
+				ldapUserItem.Policies = values
+			} else {
+				for _, group := range values {
+					ldapUserItem.Groups = append(ldapUserItem.Groups, ldapName(group, caseSensitive))
+				}
+			}
+			ldapUserMap[name] = ldapUserItem
+		}
+	}
+}
+
+// ldapStringList converts a list from the additional config to strings
+func ldapStringList(value interface{}) ([]string, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	values := []string{}
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, s)
+	}
+	return values, true
+}
+
+func configureLdapUsers(authPath string, ldapUserMap LdapUserMap) {
+	for ldap_name, ldapUserItem := range ldapUserMap {
+		userPath := path.Join("auth", authPath, "users", ldap_name)
+		task := taskWrite{
+			Path:        userPath,
+			Description: fmt.Sprintf("LDAP user mapping [%s]", userPath),
+			Data:        structToMap(ldapUserItem),
+		}
+		wg.Add(1)
+		taskChan <- task
+	}
+}
+
+func cleanupLdapUsers(authPath string, ldapUserMap LdapUserMap) {
+	for _, user_name := range getSecretList(path.Join("auth", authPath, "users")) {
+		if _, ok := ldapUserMap[user_name]; ok {
+			log.Debug("LDAP user mapping [" + user_name + "] exists in configuration, no cleanup necessary")
+		} else {
+			userPath := path.Join("auth", authPath, "users", user_name)
+			task := taskDelete{
+				Description: fmt.Sprintf("LDAP user mapping [%s]", userPath),
+				Path:        userPath,
+			}
+			taskPromptChan <- task
+		}
 	}
 }
 
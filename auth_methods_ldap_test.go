@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLdapName(t *testing.T) {
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		want          string
+	}{
+		{name: "Engineering", want: "engineering"},
+		{name: "Engineering", caseSensitive: true, want: "Engineering"},
+		{name: "CN=Dev Team,OU=Groups", want: "cn=dev team,ou=groups"},
+		{name: "dev", want: "dev"},
+	}
+
+	for _, test := range tests {
+		if got := ldapName(test.name, test.caseSensitive); got != test.want {
+			t.Errorf("ldapName(%s, %v) = %s, want %s", test.name, test.caseSensitive, got, test.want)
+		}
+	}
+}
+
+func TestConfigureLDAPAuth(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           map[string]interface{}
+		additionalConfig map[string]interface{}
+		wantWrites       map[string]map[string]interface{}
+		wantDeletes      []string
+	}{
+		{
+			name:             "groups only",
+			additionalConfig: map[string]interface{}{"policy_map": map[string]interface{}{"Engineering": []interface{}{"dev"}}},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/ldap/groups/engineering": {"policies": []string{"dev"}},
+			},
+			// User mappings aren't managed without a user map
+			wantDeletes: []string{"auth/ldap/groups/old-group"},
+		},
+		{
+			name: "user maps",
+			additionalConfig: map[string]interface{}{
+				"policy_map":      map[string]interface{}{"engineering": []interface{}{"dev"}},
+				"user_policy_map": map[string]interface{}{"SVC-Deploy": []interface{}{"deploy"}},
+				"user_group_map":  map[string]interface{}{"svc-deploy": []interface{}{"Engineering"}, "jane": []interface{}{"ops"}},
+			},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/ldap/groups/engineering": {"policies": []string{"dev"}},
+				"auth/ldap/users/svc-deploy":   {"policies": []interface{}{"deploy"}, "groups": []interface{}{"engineering"}},
+				"auth/ldap/users/jane":         {"policies": []interface{}{}, "groups": []interface{}{"ops"}},
+			},
+			wantDeletes: []string{"auth/ldap/groups/old-group", "auth/ldap/users/old-user"},
+		},
+		{
+			name:             "case sensitive names",
+			config:           map[string]interface{}{"case_sensitive_names": "true"},
+			additionalConfig: map[string]interface{}{"policy_map": map[string]interface{}{"Engineering": []interface{}{"dev"}}, "user_group_map": map[string]interface{}{"Jane": []interface{}{"Ops"}}},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/ldap/groups/Engineering": {"policies": []string{"dev"}},
+				"auth/ldap/users/Jane":         {"policies": []interface{}{}, "groups": []interface{}{"Ops"}},
+			},
+			wantDeletes: []string{"auth/ldap/groups/engineering", "auth/ldap/groups/old-group", "auth/ldap/users/old-user", "auth/ldap/users/svc-deploy"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			vault.Lists["auth/ldap/groups"] = []string{"engineering", "old-group"}
+			vault.Lists["auth/ldap/users"] = []string{"old-user", "svc-deploy"}
+			collect := captureTasks(t)
+
+			configureLDAPAuth(authMethod{Path: "ldap/", Config: test.config, AdditionalConfig: test.additionalConfig})
+			tasks := collect()
+
+			got := make(map[string]map[string]interface{})
+			for itemPath, write := range tasks.writes {
+				got[itemPath] = write.Data
+			}
+			if !reflect.DeepEqual(got, test.wantWrites) {
+				t.Errorf("configureLDAPAuth() wrote %v, want %v", got, test.wantWrites)
+			}
+			if !reflect.DeepEqual(tasks.deletes, test.wantDeletes) {
+				t.Errorf("configureLDAPAuth() prompted to delete %v, want %v", tasks.deletes, test.wantDeletes)
+			}
+		})
+	}
+}
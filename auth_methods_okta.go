@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path"
+)
+
+type AuthMethodOkta struct {
+	// Path to the auth backend (i.e. /auth/okta)
+	Path string
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+}
+
+// Policies for Okta groups and users, see
+// https://www.vaultproject.io/api/auth/okta/index.html#register-group
+type AuthMethodOktaAdditionalConfig struct {
+	Groups map[string][]string `json:"groups" yaml:"groups"`
+	Users  map[string]oktaUser `json:"users" yaml:"users"`
+}
+
+// Users can be given policies directly or through the Okta groups they're
+// added to in Vault
+type oktaUser struct {
+	Groups   []string `json:"groups" yaml:"groups"`
+	Policies []string `json:"policies" yaml:"policies"`
+}
+
+func (auth *AuthMethodOkta) Configure() {
+
+	var config AuthMethodOktaAdditionalConfig
+	unmarshalAdditionalConfig(auth.Path, auth.AdditionalConfig, &config)
+
+	groups := authMapping{Description: "Okta group", Path: path.Join(auth.Path, "groups"), Items: make(map[string]map[string]interface{})}
+	for name, policies := range config.Groups {
+		groups.Items[name] = map[string]interface{}{"policies": policies}
+	}
+
+	users := authMapping{Description: "Okta user", Path: path.Join(auth.Path, "users"), Items: make(map[string]map[string]interface{})}
+	for name, user := range config.Users {
+		users.Items[name] = structToMap(user)
+	}
+
+	groups.Configure()
+	users.Configure()
+}
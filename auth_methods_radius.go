@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path"
+)
+
+type AuthMethodRADIUS struct {
+	// Path to the auth backend (i.e. /auth/radius)
+	Path string
+
+	// AdditionalConfig for the auth backend (for example role or group mapping configurations)
+	AdditionalConfig interface{}
+}
+
+// Policies for RADIUS users, see
+// https://www.vaultproject.io/api/auth/radius/index.html#register-user
+type AuthMethodRADIUSAdditionalConfig struct {
+	Users map[string][]string `json:"users" yaml:"users"`
+}
+
+func (auth *AuthMethodRADIUS) Configure() {
+
+	var config AuthMethodRADIUSAdditionalConfig
+	unmarshalAdditionalConfig(auth.Path, auth.AdditionalConfig, &config)
+
+	users := authMapping{Description: "RADIUS user", Path: path.Join(auth.Path, "users"), Items: make(map[string]map[string]interface{})}
+	for name, policies := range config.Users {
+		users.Items[name] = map[string]interface{}{"policies": policies}
+	}
+
+	users.Configure()
+}
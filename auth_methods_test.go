@@ -0,0 +1,176 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type authRolesTestRole struct {
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+	TTL      duration `json:"ttl"`
+}
+
+func TestAuthRolesLoad(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/test/roles/file.yaml":      "policies: [file]\n",
+		"auth_methods/test/roles/team/app.json":  `{"name": "ignored", "extends": "base", "ttl": "2h"}`,
+		"templates/jwt-roles/base.yaml":          "policies: [base]\nttl: 1h\n",
+		"auth_methods/other/roles/not-used.yaml": "policies: [other]\n",
+	})
+	setSpec(t, &Spec.NameSeparator, "/")
+
+	tests := []struct {
+		name             string
+		templateKind     string
+		additionalConfig interface{}
+		want             []authRolesTestRole
+	}{
+		{
+			name:             "additional_config and files",
+			templateKind:     templateKindJWTRoles,
+			additionalConfig: map[string]interface{}{"roles": []interface{}{map[string]interface{}{"name": "config", "extends": "base"}}},
+			want: []authRolesTestRole{
+				{Name: "config", Policies: []string{"base"}, TTL: duration(time.Hour)},
+				{Name: "file", Policies: []string{"file"}},
+				{Name: "team/app", Policies: []string{"base"}, TTL: duration(2 * time.Hour)},
+			},
+		},
+		{
+			name: "no additional_config",
+			want: []authRolesTestRole{
+				{Name: "file", Policies: []string{"file"}},
+				// Without templates, extends is ignored
+				{Name: "team/app", TTL: duration(2 * time.Hour)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var roles []authRolesTestRole
+			authRoles := &authRoles{Description: "Test role", Path: "auth/test", Name: "test", TemplateKind: test.templateKind}
+			authRoles.load(test.additionalConfig, &roles)
+
+			if !reflect.DeepEqual(roles, test.want) {
+				t.Errorf("load() = %+v, want %+v", roles, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthRolesWrite(t *testing.T) {
+	vault := newTestVault(t)
+	vault.Lists["auth/test/role"] = []string{"a", "old"}
+	collect := captureTasks(t)
+
+	roles := &authRoles{Description: "Test role", Path: "auth/test", Name: "test"}
+	roles.write("a", map[string]interface{}{"name": "a", "policies": []string{"a"}}, nil)
+	roles.write("team/b", map[string]interface{}{"name": "team/b"}, func() {})
+	roles.Cleanup()
+	tasks := collect()
+
+	a := tasks.writes["auth/test/role/a"]
+	if want := map[string]interface{}{"policies": []string{"a"}}; !reflect.DeepEqual(a.Data, want) || a.Description != "Test role [auth/test/role/a]" {
+		t.Errorf("write() = %+v, want %v without the name", a, want)
+	}
+	if tasks.writes["auth/test/role/team/b"].Defer == nil {
+		t.Error("write() did not set the deferred function")
+	}
+	if !reflect.DeepEqual(tasks.deletes, []string{"auth/test/role/old"}) {
+		t.Errorf("Cleanup() prompted to delete %v, want [auth/test/role/old]", tasks.deletes)
+	}
+}
+
+func TestAuthMappings(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        interface{ Configure() }
+		existing    map[string][]string
+		wantWrites  map[string]map[string]interface{}
+		wantDeletes []string
+	}{
+		{
+			name: "GitHub",
+			auth: &AuthMethodGitHub{
+				Path:             "auth/github",
+				AdditionalConfig: map[string]interface{}{"teams": map[string]interface{}{"dev-team": []interface{}{"dev", "read"}}, "users": map[string]interface{}{"octocat": []interface{}{"admin"}}},
+			},
+			existing: map[string][]string{"auth/github/map/teams": {"dev-team", "old-team"}, "auth/github/map/users": {"old-user"}},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/github/map/teams/dev-team": {"value": "dev,read"},
+				"auth/github/map/users/octocat":  {"value": "admin"},
+			},
+			wantDeletes: []string{"auth/github/map/teams/old-team", "auth/github/map/users/old-user"},
+		},
+		{
+			name: "GitHub mixed case",
+			auth: &AuthMethodGitHub{
+				Path:             "auth/github",
+				AdditionalConfig: map[string]interface{}{"teams": map[string]interface{}{"Platform-Admins": []interface{}{"admin"}}, "users": map[string]interface{}{"OctoCat": []interface{}{"admin"}}},
+			},
+			// Vault lists the mappings lowercased
+			existing: map[string][]string{"auth/github/map/teams": {"platform-admins"}, "auth/github/map/users": {"octocat"}},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/github/map/teams/platform-admins": {"value": "admin"},
+				"auth/github/map/users/octocat":         {"value": "admin"},
+			},
+		},
+		{
+			name: "Okta",
+			auth: &AuthMethodOkta{
+				Path:             "auth/okta",
+				AdditionalConfig: map[string]interface{}{"groups": map[string]interface{}{"admins": []interface{}{"admin"}}, "users": map[string]interface{}{"jane@example.com": map[string]interface{}{"groups": []interface{}{"admins"}}}},
+			},
+			existing: map[string][]string{"auth/okta/groups": {"admins", "old"}},
+			wantWrites: map[string]map[string]interface{}{
+				"auth/okta/groups/admins":          {"policies": []string{"admin"}},
+				"auth/okta/users/jane@example.com": {"groups": []interface{}{"admins"}, "policies": nil},
+			},
+			wantDeletes: []string{"auth/okta/groups/old"},
+		},
+		{
+			name: "RADIUS",
+			auth: &AuthMethodRADIUS{
+				Path:             "auth/radius",
+				AdditionalConfig: map[string]interface{}{"users": map[string]interface{}{"jane": []interface{}{"dev"}}},
+			},
+			existing:    map[string][]string{"auth/radius/users": {"bob", "jane"}},
+			wantWrites:  map[string]map[string]interface{}{"auth/radius/users/jane": {"policies": []string{"dev"}}},
+			wantDeletes: []string{"auth/radius/users/bob"},
+		},
+		{
+			name:     "no additional_config",
+			auth:     &AuthMethodRADIUS{Path: "auth/radius"},
+			existing: map[string][]string{"auth/radius/users": {"bob"}},
+			// Users in Vault are still cleaned up
+			wantWrites:  map[string]map[string]interface{}{},
+			wantDeletes: []string{"auth/radius/users/bob"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			for listPath, keys := range test.existing {
+				vault.Lists[listPath] = keys
+			}
+			collect := captureTasks(t)
+
+			test.auth.Configure()
+			tasks := collect()
+
+			got := make(map[string]map[string]interface{})
+			for itemPath, write := range tasks.writes {
+				got[itemPath] = write.Data
+			}
+			if !reflect.DeepEqual(got, test.wantWrites) {
+				t.Errorf("Configure() wrote %v, want %v", got, test.wantWrites)
+			}
+			if !reflect.DeepEqual(tasks.deletes, test.wantDeletes) {
+				t.Errorf("Configure() prompted to delete %v, want %v", tasks.deletes, test.wantDeletes)
+			}
+		})
+	}
+}
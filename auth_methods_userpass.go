@@ -1,18 +1,29 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math/big"
+	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 type UserList map[string]interface{}
 
 // configureUserpassAuth creates/updates an userpass auth method
 func configureUserpassAuth(auth authMethod) {
+	userList := getUserpassUsers(auth)
+	userpassAddUsers(auth, userList)
+	cleanupUserpassUsers(auth.Path, userList)
+}
 
-	// Pull the users out of the additional config
+// getUserpassUsers pulls the users out of the additional config
+func getUserpassUsers(auth authMethod) UserList {
 	additionalConfig := auth.AdditionalConfig.(map[string]interface{})
 	usersData := additionalConfig["users"].([]interface{})
 
@@ -25,18 +36,71 @@ func configureUserpassAuth(auth authMethod) {
 		userList[strings.ToLower(username)] = u
 	}
 
-	userpassAddUsers(auth.Path, userList)
-	cleanupUserpassUsers(auth.Path, userList)
+	return userList
+}
+
+// hasUserpassPasswordOutput returns whether generated passwords can be handed
+// off, either to --userpass-password-path or --output
+func hasUserpassPasswordOutput() bool {
+	return Spec.UserpassPasswords != "" || Spec.Output != ""
 }
 
-func userpassAddUsers(authPath string, userList UserList) {
+// checkUserpassPasswordOutput stops before anything is configured when a
+// userpass user needs a generated password that can't be handed off
+func checkUserpassPasswordOutput(authMethodList authMethodList) {
+	if hasUserpassPasswordOutput() {
+		return
+	}
+
+	for _, auth := range authMethodList {
+		if auth.AuthOptions.Type != "userpass" {
+			continue
+		}
+
+		existingUsers := getSecretList(path.Join("auth", auth.Path, "users"))
+		for username, user := range getUserpassUsers(auth) {
+			if _, hasPassword := user.(map[string]interface{})["password"]; !hasPassword && !existingUsers.Contains(username) {
+				log.Fatalf("Userpass user [%s] needs a generated password, set --userpass-password-path or --output to hand it off", path.Join("auth", auth.Path, "users", username))
+			}
+		}
+	}
+}
+
+// userpassAddUsers creates and updates the users. Passwords are only set when
+// a user is created, either from the configuration or generated and handed
+// off once the user has been written (see deliverUserpassPassword), so users'
+// own changes aren't reset
+func userpassAddUsers(auth authMethod, userList UserList) {
+	existingUsers := getSecretList(path.Join("auth", auth.Path, "users"))
+
 	// Loop through the items and build the mapping list
-	for username, data := range userList {
-		userPath := path.Join("auth", authPath, "users", username)
+	for username, user := range userList {
+		userPath := path.Join("auth", auth.Path, "users", username)
+
+		data := make(map[string]interface{})
+		for k, v := range user.(map[string]interface{}) {
+			data[k] = v
+		}
+		password, hasPassword := data["password"]
+		delete(data, "password")
+
+		var deliver func()
+		if !existingUsers.Contains(username) {
+			if hasPassword {
+				log.Warnf("Userpass user [%s] has a password in the configuration, leave it out to have one generated", userPath)
+			} else {
+				generated, name := generatePassword(), username
+				password = generated
+				deliver = func() { deliverUserpassPassword(auth, name, generated) }
+			}
+			data["password"] = password
+		}
+
 		task := taskWrite{
 			Path:        userPath,
 			Description: fmt.Sprintf("Userpass user [%s] ", userPath),
-			Data:        data.(map[string]interface{}),
+			Data:        data,
+			Defer:       deliver,
 		}
 		wg.Add(1)
 		taskChan <- task
@@ -77,3 +141,142 @@ func cleanupUserpassUsers(authPath string, userList UserList) {
 		}
 	}
 }
+
+// Length of, and characters used in, generated passwords
+const generatedPasswordLength = 32
+const generatedPasswordCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// generatePassword generates a random password, it is masked in all log output
+func generatePassword() string {
+	max := big.NewInt(int64(len(generatedPasswordCharacters)))
+	password := make([]byte, generatedPasswordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			log.Fatal("Unable to generate password: ", err)
+		}
+		password[i] = generatedPasswordCharacters[n.Int64()]
+	}
+
+	registerSecretValue(string(password))
+	return string(password)
+}
+
+// userpassPassword is written out, response wrapped, for each generated
+// password when there is no --userpass-password-path
+type userpassPassword struct {
+	Username         string `json:"username"`
+	WrappingToken    string `json:"wrapping_token"`
+	WrappingAccessor string `json:"wrapping_accessor"`
+	WrapTTL          int    `json:"wrap_ttl"`
+	CreationTime     string `json:"creation_time"`
+}
+
+// deliverUserpassPassword hands off a generated password. It's stored in the
+// KV secrets engine at <--userpass-password-path>/<auth method>/<username>,
+// or response wrapped and written to <--output>/<auth method>/<username>.json
+func deliverUserpassPassword(auth authMethod, username string, password string) {
+	authPath := path.Join("auth", auth.Path, "users", username)
+	data := map[string]interface{}{"username": username, "password": password}
+
+	if Spec.UserpassPasswords != "" {
+		secretPath := path.Join(Spec.UserpassPasswords, auth.Name, username)
+		if err := writeKVSecret(secretPath, data); err != nil {
+			log.Fatalf("Error storing password for userpass user [%s] at [%s]: %v", authPath, secretPath, err)
+		}
+		log.Infof("Password for userpass user [%s] stored at [%s]", authPath, secretPath)
+		return
+	}
+
+	if Spec.Output == "" {
+		log.Fatalf("Unable to hand off the password for userpass user [%s], set --userpass-password-path or --output", authPath)
+	}
+
+	// Only this request is response wrapped, so use a separate client
+	client, err := VaultClient.Clone()
+	if err != nil {
+		log.Fatal(err)
+	}
+	client.SetToken(VaultClient.Token())
+	client.SetWrappingLookupFunc(func(operation, requestPath string) string {
+		return Spec.WrapTTL
+	})
+
+	secret, err := client.Logical().Write("sys/wrapping/wrap", data)
+	if err != nil {
+		log.Fatalf("Error wrapping password for userpass user [%s]: %v", authPath, err)
+	}
+	if secret == nil || secret.WrapInfo == nil {
+		log.Fatalf("Password for userpass user [%s] was not response wrapped", authPath)
+	}
+	registerSecretValue(secret.WrapInfo.Token)
+
+	wrapped := userpassPassword{
+		Username:         username,
+		WrappingToken:    secret.WrapInfo.Token,
+		WrappingAccessor: secret.WrapInfo.Accessor,
+		WrapTTL:          secret.WrapInfo.TTL,
+		CreationTime:     secret.WrapInfo.CreationTime.Format(time.RFC3339),
+	}
+	content, err := json.MarshalIndent(wrapped, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filePath := path.Join(Spec.Output, auth.Name, username+".json")
+	if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filePath, append(content, '\n'), 0600); err != nil {
+		log.Fatalf("Error writing password for userpass user [%s]: %v", authPath, err)
+	}
+
+	log.Infof("Wrapped password for userpass user [%s] written to [%s]", authPath, filePath)
+}
+
+// ResetUserpassPasswords generates new passwords for the userpass users given
+// as <auth method path>/<username> (i.e. userpass/userA), handing them off
+// the same way as the passwords of new users
+func ResetUserpassPasswords(users []string) {
+	if len(users) == 0 {
+		log.Fatal("No users given, specify them as <auth method path>/<username> (i.e. userpass/userA)")
+	}
+	if !hasUserpassPasswordOutput() {
+		log.Fatal("Unable to hand off the new passwords, set --userpass-password-path or --output")
+	}
+
+	authMethodList := authMethodList{}
+	getAuthMethods(authMethodList)
+
+	for _, user := range users {
+		i := strings.LastIndex(user, "/")
+		if i <= 0 || i == len(user)-1 {
+			log.Fatalf("Invalid user [%s], specify it as <auth method path>/<username> (i.e. userpass/userA)", user)
+		}
+
+		auth, ok := authMethodList[user[:i+1]]
+		if !ok || auth.AuthOptions.Type != "userpass" {
+			log.Fatalf("Auth method [%s] is not a userpass auth method in the configuration", user[:i+1])
+		}
+
+		// Lower the username because that's how Vault stores them
+		username := strings.ToLower(user[i+1:])
+		userPath := path.Join("auth", auth.Path, "users", username)
+		existing, err := Vault.Read(userPath)
+		if err != nil {
+			log.Fatalf("Error reading userpass user [%s]: %v", userPath, err)
+		}
+		if existing == nil {
+			log.Fatalf("Userpass user [%s] does not exist", userPath)
+		}
+
+		// The password is only handed off once Vault has it
+		password := generatePassword()
+		if _, err := Vault.Write(path.Join(userPath, "password"), map[string]interface{}{"password": password}); err != nil {
+			log.Fatalf("Error resetting password for userpass user [%s]: %v", userPath, err)
+		}
+		log.Infof("Password reset for userpass user [%s]", userPath)
+
+		deliverUserpassPassword(auth, username, password)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	VaultApi "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	resetSecretValues(t)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		password := generatePassword()
+		if len(password) != generatedPasswordLength {
+			t.Errorf("generatePassword() = %s, want %d characters", password, generatedPasswordLength)
+		}
+		if strings.Trim(password, generatedPasswordCharacters) != "" {
+			t.Errorf("generatePassword() = %s, want only [%s]", password, generatedPasswordCharacters)
+		}
+		if seen[password] {
+			t.Errorf("generatePassword() = %s more than once", password)
+		}
+		seen[password] = true
+
+		// Generated passwords are masked in log output
+		if got := redactString("password " + password); got != "password ********" {
+			t.Errorf("redactString() = %s, want the password masked", got)
+		}
+	}
+}
+
+func TestConfigureUserpassAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		passwordPath string
+		existing     bool
+		user         map[string]interface{}
+		wantData     map[string]interface{}
+		wantPassword string
+	}{
+		{
+			name:     "existing user",
+			existing: true,
+			user:     map[string]interface{}{"username": "Jane", "token_policies": []interface{}{"a"}},
+			wantData: map[string]interface{}{"username": "Jane", "token_policies": []interface{}{"a"}},
+		},
+		{
+			name:         "configured password",
+			user:         map[string]interface{}{"username": "bob", "password": "configured"},
+			wantData:     map[string]interface{}{"username": "bob"},
+			wantPassword: "configured",
+		},
+		{
+			name:         "generated password stored",
+			passwordPath: "secret/userpass",
+			user:         map[string]interface{}{"username": "bob"},
+			wantData:     map[string]interface{}{"username": "bob"},
+			wantPassword: "generated",
+		},
+		{
+			name:         "generated password wrapped",
+			user:         map[string]interface{}{"username": "bob"},
+			wantData:     map[string]interface{}{"username": "bob"},
+			wantPassword: "generated",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetSecretValues(t)
+			vault := newTestVault(t)
+			vault.Lists["auth/userpass/users"] = []string{"old"}
+			if test.existing {
+				vault.Lists["auth/userpass/users"] = append(vault.Lists["auth/userpass/users"], "jane")
+			}
+			output := t.TempDir()
+			setSpec(t, &Spec.UserpassPasswords, test.passwordPath)
+			setSpec(t, &Spec.Output, output)
+			collect := captureTasks(t)
+
+			configureUserpassAuth(authMethod{
+				Name:             "userpass",
+				Path:             "userpass/",
+				AdditionalConfig: map[string]interface{}{"users": []interface{}{test.user}},
+			})
+			tasks := collect()
+
+			userPath := "auth/userpass/users/" + strings.ToLower(test.user["username"].(string))
+			data := tasks.writes[userPath].Data
+			password, _ := data["password"].(string)
+			delete(data, "password")
+			if !reflect.DeepEqual(data, test.wantData) {
+				t.Errorf("configureUserpassAuth() wrote %s = %v, want %v", userPath, data, test.wantData)
+			}
+			if !reflect.DeepEqual(tasks.deletes, []string{"auth/userpass/users/old"}) {
+				t.Errorf("configureUserpassAuth() prompted to delete %v, want [auth/userpass/users/old]", tasks.deletes)
+			}
+
+			switch test.wantPassword {
+			case "":
+				if password != "" {
+					t.Errorf("configureUserpassAuth() set the password of an existing user")
+				}
+			case "generated":
+				if len(password) != generatedPasswordLength {
+					t.Fatalf("configureUserpassAuth() set password %s, want a generated password", password)
+				}
+			default:
+				if password != test.wantPassword {
+					t.Errorf("configureUserpassAuth() set password %s, want %s", password, test.wantPassword)
+				}
+			}
+			// Generated passwords are only handed off once the user has been
+			// written
+			if writes := vault.requests("PUT"); len(writes) != 0 {
+				t.Errorf("configureUserpassAuth() handed off a password to %v before the user was written", writes)
+			}
+			if test.wantPassword != "generated" {
+				if tasks.writes[userPath].Defer != nil {
+					t.Errorf("configureUserpassAuth() handed off a password that wasn't generated")
+				}
+				return
+			}
+			tasks.writes[userPath].Defer()
+
+			// They're either stored in the KV secrets engine or response wrapped
+			// and written to the output directory
+			if test.passwordPath != "" {
+				stored := vault.Data["secret/userpass/userpass/bob"]
+				if want := map[string]interface{}{"username": "bob", "password": password}; !reflect.DeepEqual(stored, want) {
+					t.Errorf("configureUserpassAuth() stored %v, want %v", stored, want)
+				}
+				return
+			}
+
+			if wrapped := vault.Data["sys/wrapping/wrap"]; !reflect.DeepEqual(wrapped, map[string]interface{}{"username": "bob", "password": password}) {
+				t.Errorf("configureUserpassAuth() wrapped %v, want the generated password", wrapped)
+			}
+			content, err := ioutil.ReadFile(filepath.Join(output, "userpass", "bob.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got userpassPassword
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := userpassPassword{
+				Username:         "bob",
+				WrappingToken:    "wrapped-sys/wrapping/wrap",
+				WrappingAccessor: "accessor-sys/wrapping/wrap",
+				WrapTTL:          300,
+				CreationTime:     "2020-01-01T00:00:00Z",
+			}
+			if got != want {
+				t.Errorf("configureUserpassAuth() wrote %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckUserpassPasswordOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       string
+		users        []interface{}
+		wantPrevents bool
+	}{
+		{
+			name:  "existing user",
+			users: []interface{}{map[string]interface{}{"username": "Jane"}},
+		},
+		{
+			name:  "configured password",
+			users: []interface{}{map[string]interface{}{"username": "bob", "password": "configured"}},
+		},
+		{
+			name:         "generated password",
+			users:        []interface{}{map[string]interface{}{"username": "bob"}},
+			wantPrevents: true,
+		},
+		{
+			name:   "generated password with an output",
+			output: "passwords",
+			users:  []interface{}{map[string]interface{}{"username": "bob"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			vault.Lists["auth/userpass/users"] = []string{"jane"}
+			setSpec(t, &Spec.UserpassPasswords, "")
+			setSpec(t, &Spec.Output, test.output)
+
+			var prevented bool
+			previous := log.StandardLogger().ExitFunc
+			log.StandardLogger().ExitFunc = func(int) { prevented = true }
+			defer func() { log.StandardLogger().ExitFunc = previous }()
+
+			checkUserpassPasswordOutput(authMethodList{"userpass/": authMethod{
+				Path:             "userpass/",
+				AuthOptions:      VaultApi.EnableAuthOptions{Type: "userpass"},
+				AdditionalConfig: map[string]interface{}{"users": test.users},
+			}})
+			if prevented != test.wantPrevents {
+				t.Errorf("checkUserpassPasswordOutput() stopped = %v, want %v", prevented, test.wantPrevents)
+			}
+		})
+	}
+}
+
+func TestResetUserpassPasswords(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"auth_methods/userpass.json": `{"auth_options": {"type": "userpass"}, "additional_config": {"users": [{"username": "bob"}]}}`,
+	})
+	resetSecretValues(t)
+	vault := newTestVault(t)
+	vault.Data["auth/userpass/users/bob"] = map[string]interface{}{}
+	setSpec(t, &Spec.UserpassPasswords, "secret/userpass")
+
+	ResetUserpassPasswords([]string{"userpass/Bob"})
+
+	// The password is only handed off once Vault has it
+	var writes []string
+	for _, request := range vault.Requests {
+		if strings.HasPrefix(request, "PUT ") {
+			writes = append(writes, strings.TrimPrefix(request, "PUT "))
+		}
+	}
+	if want := []string{"auth/userpass/users/bob/password", "secret/userpass/userpass/bob"}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("ResetUserpassPasswords() wrote %v, want %v", writes, want)
+	}
+
+	password := vault.Data["auth/userpass/users/bob/password"]["password"]
+	if stored := vault.Data["secret/userpass/userpass/bob"]["password"]; stored != password {
+		t.Errorf("ResetUserpassPasswords() stored password %v, want %v", stored, password)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// bundleDocument is one configuration item in a bundle. The spec is either
+// the item's configuration or, as a string, the raw content of its file (i.e.
+// an HCL policy or a file using templates outside of strings)
+type bundleDocument struct {
+	Kind string `yaml:"kind"`
+	Name string `yaml:"name"`
+	// Secrets engine mount or auth method that the item belongs to (roles only)
+	Mount string `yaml:"mount,omitempty"`
+	// Format of a raw spec: json, yaml, hcl, pem or crt. Detected if not set
+	Format string    `yaml:"format,omitempty"`
+	Spec   yaml.Node `yaml:"spec"`
+}
+
+// Kinds of bundle documents and where each is placed in the configuration
+// directory. {name} and {mount} are replaced with the document's name and mount
+var bundleKinds = map[string]string{
+	"AuditDevice":    "audit_devices/{name}",
+	"AuthMethod":     "auth_methods/{name}",
+	"AuthMethodRole": "auth_methods/{mount}/roles/{name}",
+	// A certificate's metadata is a separate document with the same name
+	"AuthMethodCert":     "auth_methods/{mount}/certs/{name}",
+	"AuthMethodCertMeta": "auth_methods/{mount}/certs/{name}",
+	"Policy":             "policies/{name}",
+	"TokenRole":          "token_roles/{name}",
+	"SecretsEngine":      "secrets-engines/{name}/config",
+	"AwsConfig":          "secrets-engines/{name}/aws",
+	"DatabaseConfig":     "secrets-engines/{name}/db",
+	"Role":               "secrets-engines/{mount}/roles/{name}",
+	"IdentityEntity":     "secrets-engines/identity/entities/{name}",
+	"IdentityGroup":      "secrets-engines/identity/groups/{name}",
+	"Template":           "templates/{name}",
+	"Vars":               "vars/{name}",
+}
+
+// isBundle returns whether the configuration path is a bundle (a file, or -
+// for stdin) rather than a configuration directory
+func isBundle(configurationPath string) bool {
+	if configurationPath == "-" {
+		return true
+	}
+	info, err := os.Stat(configurationPath)
+	return err == nil && !info.IsDir()
+}
+
+// loadConfigurationBundle expands the configuration bundle, if one is being
+// used, into a temporary directory so it's loaded the same way as a
+// configuration directory
+func loadConfigurationBundle() {
+	if !isBundle(Spec.ConfigurationPath) {
+		return
+	}
+
+	bundleName := Spec.ConfigurationPath
+	if bundleName == "-" {
+		bundleName = "stdin"
+	}
+
+	documents, err := readBundle(Spec.ConfigurationPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bundleDir := newTempConfigurationDir("vault-admin-bundle")
+	files, err := expandBundle(documents, bundleDir)
+	if err != nil {
+		log.Fatalf("Error in bundle [%s]: %v", bundleName, err)
+	}
+
+	// Report problems against the bundle documents rather than the temporary files
+	labels := map[string]string{bundleDir: bundleName}
+	for filePath, description := range files {
+		labels[filePath] = fmt.Sprintf("%s [%s]", bundleName, description)
+	}
+	labelConfigurationPaths(labels)
+
+	log.Debugf("Bundle [%s] expanded into [%s]", bundleName, bundleDir)
+	Spec.ConfigurationPath = bundleDir
+}
+
+// readBundle reads in the documents of a YAML or JSON bundle. A bundle is
+// either a stream of YAML documents or lists of documents (i.e. a JSON array)
+func readBundle(bundlePath string) ([]bundleDocument, error) {
+	var content []byte
+	var err error
+	if bundlePath == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(bundlePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading bundle [%s]: %v", bundlePath, err)
+	}
+
+	var documents []bundleDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Bundle [%s] is not valid: %v", bundlePath, err)
+		}
+
+		if len(node.Content) == 0 {
+			continue
+		}
+
+		root := node.Content[0]
+		items := []*yaml.Node{root}
+		if root.Kind == yaml.SequenceNode {
+			items = root.Content
+		}
+
+		for _, item := range items {
+			var document bundleDocument
+			if err := item.Decode(&document); err != nil {
+				return nil, fmt.Errorf("Bundle [%s] line %d: %v", bundlePath, item.Line, err)
+			}
+			documents = append(documents, document)
+		}
+	}
+
+	return documents, nil
+}
+
+// bundleDocumentPath returns the path, relative to the configuration
+// directory and without extension, of a bundle document's file
+func bundleDocumentPath(document bundleDocument) (string, error) {
+	pattern, ok := bundleKinds[document.Kind]
+	if !ok {
+		return "", fmt.Errorf("Unknown kind [%s]", document.Kind)
+	}
+
+	if document.Name == "" {
+		return "", fmt.Errorf("%s has no name", document.Kind)
+	}
+	if strings.Contains(pattern, "{mount}") && document.Mount == "" {
+		return "", fmt.Errorf("%s [%s] has no mount", document.Kind, document.Name)
+	}
+
+	for _, part := range []string{document.Name, document.Mount} {
+		if path.IsAbs(part) || SecretList(strings.Split(part, "/")).Contains("..") {
+			return "", fmt.Errorf("%s [%s] has an invalid name or mount", document.Kind, document.Name)
+		}
+	}
+
+	return strings.NewReplacer("{name}", document.Name, "{mount}", document.Mount).Replace(pattern), nil
+}
+
+// bundleDocumentFile returns the file extension and content for a bundle
+// document. Raw specs are written as-is, anything else is written as YAML
+func bundleDocumentFile(document bundleDocument) (string, []byte, error) {
+	if document.Spec.Kind == yaml.ScalarNode && document.Spec.ShortTag() == "!!str" {
+		content := []byte(document.Spec.Value)
+		switch document.Format {
+		case "json", "yaml", "hcl", "pem", "crt":
+			return "." + document.Format, content, nil
+		case "":
+			if isJSON(document.Spec.Value) {
+				return ".json", content, nil
+			} else if document.Kind == "Policy" {
+				return ".hcl", content, nil
+			} else if document.Kind == "AuthMethodCert" {
+				return ".pem", content, nil
+			}
+			return ".yaml", content, nil
+		default:
+			return "", nil, fmt.Errorf("%s [%s] has unknown format [%s]", document.Kind, document.Name, document.Format)
+		}
+	}
+
+	if document.Spec.Kind != yaml.MappingNode {
+		return "", nil, fmt.Errorf("%s [%s] spec must be an object or the content of a file", document.Kind, document.Name)
+	}
+
+	content, err := yaml.Marshal(&document.Spec)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s [%s]: %v", document.Kind, document.Name, err)
+	}
+
+	return ".yaml", content, nil
+}
+
+// expandBundle writes out the documents of a bundle as a configuration
+// directory. It returns a description of each document by file path
+func expandBundle(documents []bundleDocument, dirPath string) (map[string]string, error) {
+	files := make(map[string]string)
+	itemPaths := make(map[string]string)
+
+	for i, document := range documents {
+		description := fmt.Sprintf("%s %s", document.Kind, document.Name)
+		if document.Mount != "" {
+			description = fmt.Sprintf("%s %s/%s", document.Kind, document.Mount, document.Name)
+		}
+
+		itemPath, err := bundleDocumentPath(document)
+		if err != nil {
+			return nil, fmt.Errorf("Document %d: %v", i+1, err)
+		}
+		if existing, ok := itemPaths[document.Kind+" "+itemPath]; ok {
+			return nil, fmt.Errorf("[%s] is in the bundle more than once (documents %s and %d)", description, existing, i+1)
+		}
+		itemPaths[document.Kind+" "+itemPath] = fmt.Sprint(i + 1)
+
+		ext, content, err := bundleDocumentFile(document)
+		if err != nil {
+			return nil, fmt.Errorf("Document %d: %v", i+1, err)
+		}
+
+		filePath := path.Join(dirPath, itemPath+ext)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+			return nil, err
+		}
+		files[filePath] = description
+	}
+
+	return files, nil
+}
+
+// directoryToBundle reads in a configuration directory as bundle documents.
+// File content is kept as-is, so the bundle is equivalent to the directory,
+// unless renderTemplates is set
+func directoryToBundle(dirPath string, renderTemplates bool) ([]bundleDocument, error) {
+	var documents []bundleDocument
+
+	// addEntries adds configuration files as documents of a kind
+	addEntries := func(kind string, mount string, relPath string, entries []configEntry) error {
+		for _, entry := range entries {
+			name, _ := filepath.Rel(path.Join(dirPath, relPath), entry.Path)
+			document, err := readBundleDocument(kind, strings.TrimSuffix(name, filepath.Ext(name)), mount, entry.Path, renderTemplates && kind != "AuthMethodCert")
+			if err != nil {
+				return err
+			}
+			documents = append(documents, document)
+		}
+		return nil
+	}
+
+	// add adds the files in a configuration directory as documents of a kind
+	add := func(kind string, mount string, relPath string, isValidFile func(string) bool, skipItemDirs bool) error {
+		entries, skipped, err := walkConfigDirectory(path.Join(dirPath, relPath), isValidFile, skipItemDirs)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(skipped) > 0 {
+			return fmt.Errorf("[%s] can't be included in a bundle", skipped[0])
+		}
+
+		return addEntries(kind, mount, relPath, entries)
+	}
+
+	// addFile adds a single file of a secrets engine, if it exists
+	addFile := func(kind string, engineDir string, name string) error {
+		filePath, ok := findConfigFile(path.Join(dirPath, "secrets-engines", engineDir), name)
+		if !ok {
+			return nil
+		}
+		document, err := readBundleDocument(kind, engineDir, "", filePath, renderTemplates)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, document)
+		return nil
+	}
+
+	if err := add("AuditDevice", "", "audit_devices", isConfigFile, false); err != nil {
+		return nil, err
+	}
+	if err := add("AuthMethod", "", "auth_methods", isConfigFile, true); err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if document.Kind == "AuthMethod" {
+			if err := add("AuthMethodRole", document.Name, path.Join("auth_methods", document.Name, "roles"), isConfigFile, false); err != nil {
+				return nil, err
+			}
+
+			certsPath := path.Join("auth_methods", document.Name, "certs")
+			certEntries, metadataEntries, skipped, err := walkCertDirectory(path.Join(dirPath, certsPath))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if len(skipped) > 0 {
+				return nil, fmt.Errorf("[%s] can't be included in a bundle", skipped[0])
+			}
+			if err := addEntries("AuthMethodCert", document.Name, certsPath, certEntries); err != nil {
+				return nil, err
+			}
+			if err := addEntries("AuthMethodCertMeta", document.Name, certsPath, metadataEntries); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := add("Policy", "", "policies", isPolicyFile, false); err != nil {
+		return nil, err
+	}
+	if err := add("TokenRole", "", "token_roles", isConfigFile, false); err != nil {
+		return nil, err
+	}
+
+	engineDirs, err := findSecretsEngineDirs(path.Join(dirPath, "secrets-engines"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, engineDir := range engineDirs {
+		if engineDir.Path == "identity" {
+			if err := add("IdentityEntity", "", "secrets-engines/identity/entities", isConfigFile, false); err != nil {
+				return nil, err
+			}
+			if err := add("IdentityGroup", "", "secrets-engines/identity/groups", isConfigFile, false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := addFile("SecretsEngine", engineDir.Path, "config"); err != nil {
+			return nil, err
+		}
+		if err := addFile("AwsConfig", engineDir.Path, "aws"); err != nil {
+			return nil, err
+		}
+		if err := addFile("DatabaseConfig", engineDir.Path, "db"); err != nil {
+			return nil, err
+		}
+		if err := add("Role", engineDir.Path, path.Join("secrets-engines", engineDir.Path, "roles"), isConfigFile, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := add("Template", "", "templates", isConfigFile, false); err != nil {
+		return nil, err
+	}
+	if err := add("Vars", "", "vars", isConfigFile, false); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// readBundleDocument reads in a configuration file as a bundle document. Files
+// that can be parsed as an object are included as structured YAML, anything
+// else is included as the raw content
+func readBundleDocument(kind string, name string, mount string, filePath string, renderTemplates bool) (bundleDocument, error) {
+	document := bundleDocument{Kind: kind, Name: name, Mount: mount}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return document, fmt.Errorf("Error reading file [%s]: %v", filePath, err)
+	}
+
+	if renderTemplates {
+		content, err = renderTemplate(filePath, content)
+		if err != nil {
+			return document, fmt.Errorf("Error rendering template [%s]: %v", filePath, err)
+		}
+	}
+
+	var node yaml.Node
+	if !checkExt(filePath, ".hcl") && yaml.Unmarshal(content, &node) == nil && len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode {
+		clearNodeStyle(node.Content[0])
+		document.Spec = *node.Content[0]
+		return document, nil
+	}
+
+	document.Format = strings.TrimPrefix(filepath.Ext(filePath), ".")
+	if document.Format == "yml" {
+		document.Format = "yaml"
+	}
+	document.Spec = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(content), Style: yaml.LiteralStyle}
+	return document, nil
+}
+
+// clearNodeStyle resets the style of a parsed node so JSON content is written
+// out as block style YAML
+func clearNodeStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+	for _, child := range node.Content {
+		clearNodeStyle(child)
+	}
+}
+
+// writeBundle writes out bundle documents as a multi-document YAML stream
+func writeBundle(documents []bundleDocument, w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(&document); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// ConvertConfiguration converts a configuration directory into a bundle, or a
+// bundle into a configuration directory
+func ConvertConfiguration() {
+	if isBundle(Spec.ConfigurationPath) {
+		if Spec.Output == "" {
+			log.Fatal("An output directory (--output) is required to convert a bundle")
+		}
+		if files, err := ioutil.ReadDir(Spec.Output); err == nil && len(files) > 0 {
+			log.Fatalf("Output directory [%s] is not empty", Spec.Output)
+		}
+
+		documents, err := readBundle(Spec.ConfigurationPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := expandBundle(documents, Spec.Output); err != nil {
+			log.Fatalf("Error converting bundle [%s]: %v", Spec.ConfigurationPath, err)
+		}
+
+		log.Infof("Bundle [%s] converted to directory [%s]", Spec.ConfigurationPath, Spec.Output)
+		return
+	}
+
+	documents, err := directoryToBundle(Spec.ConfigurationPath, false)
+	if err != nil {
+		log.Fatalf("Error converting configuration [%s]: %v", Spec.ConfigurationPath, err)
+	}
+
+	writeBundleOutput(documents)
+	if Spec.Output != "" && Spec.Output != "-" {
+		log.Infof("Configuration [%s] converted to bundle [%s]", Spec.ConfigurationPath, Spec.Output)
+	}
+}
+
+// RenderConfiguration writes out the composed configuration (the bundle or
+// directory with any overlays applied) as a bundle with its templates
+// rendered, for review. Substitutions are left in place
+func RenderConfiguration() {
+	documents, err := directoryToBundle(Spec.ConfigurationPath, true)
+	if err != nil {
+		log.Fatalf("Error rendering configuration: %v", err)
+	}
+
+	writeBundleOutput(documents)
+}
+
+// writeBundleOutput writes out a bundle to --output, or stdout if not set
+func writeBundleOutput(documents []bundleDocument) {
+	if Spec.Output == "" || Spec.Output == "-" {
+		if err := writeBundle(documents, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeBundle(documents, &buf); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(Spec.Output, buf.Bytes(), 0600); err != nil {
+		log.Fatalf("Error writing bundle [%s]: %v", Spec.Output, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	policy := "path \"secret/*\" {\n  capabilities = [\"read\"]\n}\n"
+	files := map[string]string{
+		"audit_devices/file.json":                    `{"type": "file", "options": {"file_path": "/vault/audit.log"}}`,
+		"auth_methods/approle.yaml":                  "type: approle\ndescription: AppRole\n",
+		"auth_methods/approle/roles/team/app.json":   `{"token_policies": ["app"], "token_ttl": "1h"}`,
+		"auth_methods/cert.json":                     `{"type": "cert"}`,
+		"auth_methods/cert/certs/web.pem":            "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+		"auth_methods/cert/certs/web.json":           `{"token_policies": ["web"]}`,
+		"policies/read.hcl":                          policy,
+		"policies/write.yaml":                        "path:\n  secret/*:\n    capabilities: [create]\n",
+		"token_roles/ci.yaml":                        "allowed_policies: [ci]\n",
+		"secrets-engines/aws/config.json":            `{"type": "aws"}`,
+		"secrets-engines/aws/aws.yaml":               "client:\n  access_key: \"%{ACCESS_KEY}%\"\n",
+		"secrets-engines/aws/roles/deploy.yaml":      "credential_type: iam_user\nextends: base\n",
+		"secrets-engines/identity/groups/admin.json": `{"policies": ["admin"]}`,
+		"templates/aws-roles/base.yaml":              "default_sts_ttl: 1h\n",
+		"vars/default.yaml":                          "local: true\n",
+		"auth_methods/userpass.json":                 "{\n  \"type\": \"userpass\",\n  \"local\": %{{ .Vars.local }}%\n}\n",
+	}
+	dir := writeConfigDir(t, files)
+
+	documents, err := directoryToBundle(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != len(files) {
+		t.Errorf("directoryToBundle() returned %d documents, want %d", len(documents), len(files))
+	}
+
+	var buf bytes.Buffer
+	if err := writeBundle(documents, &buf); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "bundle.yaml")
+	if err := ioutil.WriteFile(bundlePath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	documents, err = readBundle(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expandedDir := t.TempDir()
+	expanded, err := expandBundle(documents, expandedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expanded) != len(files) {
+		t.Errorf("expandBundle() wrote %d files, want %d", len(expanded), len(files))
+	}
+
+	// Structured files are written back as YAML, raw files (including ones
+	// with templates outside of strings) keep their content
+	for name, content := range files {
+		expandedPath, ok := findConfigFile(filepath.Join(expandedDir, filepath.Dir(name)), fileBaseName(name))
+		if !isConfigFile(name) {
+			expandedPath, ok = filepath.Join(expandedDir, name), true
+		}
+		got, err := ioutil.ReadFile(expandedPath)
+		if !ok || err != nil {
+			t.Errorf("%s was not expanded: %v", name, err)
+			continue
+		}
+
+		if !isConfigFile(name) || strings.Contains(content, "%{{") {
+			if string(got) != content {
+				t.Errorf("%s = %q, want %q", name, got, content)
+			}
+			continue
+		}
+
+		var gotValue, wantValue interface{}
+		gotJSON, _ := yamlToJSON(got)
+		wantJSON, _ := yamlToJSON([]byte(content))
+		json.Unmarshal(gotJSON, &gotValue)
+		json.Unmarshal(wantJSON, &wantValue)
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("%s = %s, want %s", name, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestExpandBundleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  string
+		wantErr string
+	}{
+		{
+			name:    "unknown kind",
+			bundle:  "kind: Secret\nname: a\nspec: {}\n",
+			wantErr: "Document 1: Unknown kind [Secret]",
+		},
+		{
+			name:    "missing mount",
+			bundle:  "kind: Role\nname: a\nspec: {}\n",
+			wantErr: "Document 1: Role [a] has no mount",
+		},
+		{
+			name:    "path traversal",
+			bundle:  "kind: Policy\nname: ../a\nspec: {}\n",
+			wantErr: "Document 1: Policy [../a] has an invalid name or mount",
+		},
+		{
+			name:    "duplicate",
+			bundle:  "- kind: Policy\n  name: a\n  spec: {}\n- kind: Policy\n  name: a\n  spec: {}\n",
+			wantErr: "[Policy a] is in the bundle more than once (documents 1 and 2)",
+		},
+		{
+			name:    "list spec",
+			bundle:  "kind: Policy\nname: a\nspec: [a]\n",
+			wantErr: "Document 1: Policy [a] spec must be an object or the content of a file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bundlePath := filepath.Join(t.TempDir(), "bundle.yaml")
+			if err := ioutil.WriteFile(bundlePath, []byte(test.bundle), 0600); err != nil {
+				t.Fatal(err)
+			}
+			documents, err := readBundle(bundlePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := expandBundle(documents, t.TempDir()); err == nil || err.Error() != test.wantErr {
+				t.Errorf("expandBundle() error = %v, want %s", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+# Policies can be written in HCL
+path "aws-main/creds/admin" {
+  capabilities = ["read"]
+}
+
+path "secret/qa/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Kinds of configuration items that can extend templates. Each kind has its
+// own directory of templates under templates/
+const (
+	templateKindAwsRoles       = "aws-roles"
+	templateKindDatabaseRoles  = "database-roles"
+	templateKindJWTRoles       = "jwt-roles"
+	templateKindIdentityGroups = "identity-groups"
+)
+
+// applyExtends resolves the extends key of a configuration item (as JSON). The
+// item's fields are deep merged over the template(s) it extends. Content that
+// isn't a JSON object is returned as-is so the error is reported by the caller
+func applyExtends(kind string, content []byte) ([]byte, error) {
+	var item map[string]interface{}
+	if json.Unmarshal(content, &item) != nil {
+		return content, nil
+	}
+
+	if _, ok := item["extends"]; !ok {
+		return content, nil
+	}
+
+	resolved, err := resolveExtends(kind, item, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(resolved)
+}
+
+// applyExtendsToList resolves the extends key of each item in a list of
+// configuration items, such as the JWT/OIDC roles in additional_config
+func applyExtendsToList(kind string, list interface{}) (interface{}, error) {
+	items, ok := list.([]interface{})
+	if !ok {
+		return list, nil
+	}
+
+	resolvedItems := make([]interface{}, len(items))
+	for i, item := range items {
+		resolvedItems[i] = item
+		if m, ok := item.(map[string]interface{}); ok {
+			resolved, err := resolveExtends(kind, m, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Item %d: %v", i, err)
+			}
+			resolvedItems[i] = resolved
+		}
+	}
+
+	return resolvedItems, nil
+}
+
+// resolveExtends merges an item over the templates it extends. Templates can
+// themselves extend other templates, chain holds the templates already being
+// resolved so cycles can be detected
+func resolveExtends(kind string, item map[string]interface{}, chain []string) (map[string]interface{}, error) {
+	extends, ok := item["extends"]
+	if !ok {
+		return item, nil
+	}
+
+	var names []string
+	switch v := extends.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, name := range v {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("extends must be a template name or list of template names")
+			}
+			names = append(names, s)
+		}
+	default:
+		return nil, fmt.Errorf("extends must be a template name or list of template names")
+	}
+
+	// Templates listed later take precedence over earlier ones
+	base := make(map[string]interface{})
+	for _, name := range names {
+		if SecretList(chain).Contains(name) {
+			return nil, fmt.Errorf("Template [%s] extends itself (%s -> %s)", name, strings.Join(chain, " -> "), name)
+		}
+
+		template, err := readTemplate(kind, name)
+		if err != nil {
+			return nil, err
+		}
+
+		resolvedTemplate, err := resolveExtends(kind, template, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+
+		base = deepMerge(base, resolvedTemplate)
+	}
+
+	fields := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		if k != "extends" {
+			fields[k] = v
+		}
+	}
+
+	return deepMerge(base, fields), nil
+}
+
+// readTemplate reads in a template from templates/<kind>/<name>
+func readTemplate(kind string, name string) (map[string]interface{}, error) {
+	templatePath := path.Join(Spec.ConfigurationPath, "templates", kind)
+	filePath, ok := findConfigFile(templatePath, name)
+	if !ok {
+		return nil, fmt.Errorf("Template [%s] not found in [%s]", name, templatePath)
+	}
+
+	content, err := readConfigFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var template map[string]interface{}
+	if err := json.Unmarshal(content, &template); err != nil {
+		return nil, fmt.Errorf("Template [%s] must be an object: %v", filePath, err)
+	}
+
+	return template, nil
+}
+
+// deepMerge returns the result of merging override over base. Objects are
+// merged, anything else (including lists) is replaced. A null value in
+// override removes the field
+func deepMerge(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		result[k] = v
+	}
+
+	for k, v := range override {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+
+		baseMap, baseIsMap := result[k].(map[string]interface{})
+		overrideMap, overrideIsMap := v.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			result[k] = deepMerge(baseMap, overrideMap)
+		} else {
+			result[k] = v
+		}
+	}
+
+	return result
+}
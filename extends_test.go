@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeepMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name:     "fields",
+			base:     `{"a": 1, "b": 2}`,
+			override: `{"b": 3, "c": 4}`,
+			want:     `{"a": 1, "b": 3, "c": 4}`,
+		},
+		{
+			name:     "objects are merged",
+			base:     `{"tags": {"a": 1, "b": 2}}`,
+			override: `{"tags": {"b": 3}}`,
+			want:     `{"tags": {"a": 1, "b": 3}}`,
+		},
+		{
+			name:     "lists are replaced",
+			base:     `{"policies": ["a", "b"]}`,
+			override: `{"policies": ["c"]}`,
+			want:     `{"policies": ["c"]}`,
+		},
+		{
+			name:     "null removes",
+			base:     `{"a": 1, "tags": {"a": 1, "b": 2}}`,
+			override: `{"a": null, "tags": {"b": null}}`,
+			want:     `{"tags": {"a": 1}}`,
+		},
+		{
+			name:     "object replaces value",
+			base:     `{"a": "value"}`,
+			override: `{"a": {"b": 1}}`,
+			want:     `{"a": {"b": 1}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var base, override, want map[string]interface{}
+			for _, v := range []struct {
+				content string
+				target  *map[string]interface{}
+			}{{test.base, &base}, {test.override, &override}, {test.want, &want}} {
+				if err := json.Unmarshal([]byte(v.content), v.target); err != nil {
+					t.Fatal(err)
+				}
+			}
+			baseCopy := deepMerge(nil, base)
+
+			if got := deepMerge(base, override); !reflect.DeepEqual(got, want) {
+				t.Errorf("deepMerge() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(base, baseCopy) {
+				t.Errorf("deepMerge() modified base: %v, want %v", base, baseCopy)
+			}
+		})
+	}
+}
+
+func TestApplyExtends(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"templates/aws-roles/base.yaml":     "credential_type: iam_user\ndefault_sts_ttl: 1h\npolicy_arns: [arn:base]\n",
+		"templates/aws-roles/readonly.json": `{"extends": "base", "policy_arns": ["arn:readonly"], "tags": {"team": "a"}}`,
+		"templates/aws-roles/tagged.yaml":   "tags:\n  env: prod\n",
+		"templates/aws-roles/loop-a.yaml":   "extends: loop-b\n",
+		"templates/aws-roles/loop-b.yaml":   "extends: loop-a\n",
+	})
+
+	tests := []struct {
+		name    string
+		item    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no extends",
+			item: `{"credential_type": "assumed_role"}`,
+			want: `{"credential_type": "assumed_role"}`,
+		},
+		{
+			name: "single template",
+			item: `{"extends": "base", "default_sts_ttl": "2h"}`,
+			want: `{"credential_type": "iam_user", "default_sts_ttl": "2h", "policy_arns": ["arn:base"]}`,
+		},
+		{
+			name: "chained templates",
+			item: `{"extends": "readonly"}`,
+			want: `{"credential_type": "iam_user", "default_sts_ttl": "1h", "policy_arns": ["arn:readonly"], "tags": {"team": "a"}}`,
+		},
+		{
+			name: "later templates take precedence",
+			item: `{"extends": ["readonly", "tagged"], "tags": {"team": "b"}}`,
+			want: `{"credential_type": "iam_user", "default_sts_ttl": "1h", "policy_arns": ["arn:readonly"], "tags": {"env": "prod", "team": "b"}}`,
+		},
+		{
+			name:    "missing template",
+			item:    `{"extends": "missing"}`,
+			wantErr: "Template [missing] not found",
+		},
+		{
+			name:    "cycle",
+			item:    `{"extends": "loop-a"}`,
+			wantErr: "Template [loop-a] extends itself (loop-a -> loop-b -> loop-a)",
+		},
+		{
+			name:    "invalid extends",
+			item:    `{"extends": 1}`,
+			wantErr: "extends must be a template name or list of template names",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyExtends(templateKindAwsRoles, []byte(test.item))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("applyExtends() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotItem, wantItem interface{}
+			json.Unmarshal(got, &gotItem)
+			json.Unmarshal([]byte(test.want), &wantItem)
+			if !reflect.DeepEqual(gotItem, wantItem) {
+				t.Errorf("applyExtends() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
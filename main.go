@@ -14,15 +14,29 @@ import (
 
 // Application options
 type Specification struct {
-	ConfigurationPath   string `vrequired:"true" envconfig:"CONFIGURATION_PATH" short:"c" long:"configuration-path" description:"Path to the configuration files"`
-	VaultAddress        string `vrequired:"true" envconfig:"VAULT_ADDR" short:"a" long:"vault-addr" description:"Vault address (ex: https://vault.mysite.com:8200)"`
-	VaultToken          string `envconfig:"VAULT_TOKEN" short:"t" long:"vault-token" description:"Vault token to use, otherwise will prompt for LDAP credentials"`
-	VaultSkipVerify     bool   `envconfig:"VAULT_SKIP_VERIFY" short:"K" long:"skip-verify" description:"Skip Vault TLS certificate verification"`
-	VaultSecretBasePath string `envconfig:"VAULT_SECRET_BASE_PATH" short:"s" long:"vault-secret-base-path" description:"Base secret path, in Vault, to pull secrets for substitution" vdefault:"secret/vault-admin/"`
-	RotateCreds         bool   `short:"r" long:"rotate-creds" description:"Rotates AWS root credentials" vdefault:"false"`
-	Concurrency         string `short:"n" long:"concurrent" description:"Number of concurrent threads to run (default: 5)" vdefault:"5"`
-	Debug               bool   `envconfig:"DEBUG" short:"d" long:"debug" description:"Turn on debug logging"`
-	Version             bool   `short:"v" long:"version" description:"Display the version of the tool"`
+	ConfigurationPath   string   `vrequired:"true" envconfig:"CONFIGURATION_PATH" short:"c" long:"configuration-path" description:"Path to the configuration directory, or a configuration bundle file (- for stdin)"`
+	VaultAddress        string   `vrequired:"vault" envconfig:"VAULT_ADDR" short:"a" long:"vault-addr" description:"Vault address (ex: https://vault.mysite.com:8200)"`
+	VaultToken          string   `redact:"true" envconfig:"VAULT_TOKEN" short:"t" long:"vault-token" description:"Vault token to use, otherwise will prompt for LDAP credentials"`
+	VaultSkipVerify     bool     `envconfig:"VAULT_SKIP_VERIFY" short:"K" long:"skip-verify" description:"Skip Vault TLS certificate verification"`
+	VaultSecretBasePath string   `envconfig:"VAULT_SECRET_BASE_PATH" short:"s" long:"vault-secret-base-path" description:"Base secret path, in Vault, to pull secrets for substitution" vdefault:"secret/vault-admin/"`
+	SecretVersion       string   `envconfig:"VAULT_SECRET_VERSION" long:"secret-version" description:"Version of the substitution secrets to read (KV version 2 only)"`
+	SubstitutionSource  string   `envconfig:"SUBSTITUTION_SOURCE" long:"substitution-source" description:"Default source of substitution values (vault, env, file, dotenv, sops, age)" vdefault:"vault"`
+	DotenvFile          string   `envconfig:"DOTENV_FILE" long:"dotenv-file" description:"Dotenv file for the dotenv substitution source"`
+	SopsFile            string   `envconfig:"SOPS_FILE" long:"sops-file" description:"SOPS encrypted YAML file for the sops substitution source"`
+	AgeFile             string   `envconfig:"AGE_FILE" long:"age-file" description:"age encrypted YAML file for the age substitution source"`
+	AgeIdentity         string   `envconfig:"AGE_IDENTITY" long:"age-identity" description:"age identity (private key) file used to decrypt the age file"`
+	Overlays            []string `envconfig:"OVERLAYS" long:"overlay" description:"Overlay directory applied over the configuration, can be repeated"`
+	NameSeparator       string   `envconfig:"NAME_SEPARATOR" long:"name-separator" description:"Separator used to join subdirectories into names (default: /)" vdefault:"/"`
+	FlattenDirectories  bool     `envconfig:"FLATTEN_DIRECTORIES" long:"flatten-directories" description:"Only use subdirectories for organisation, names are taken from the filename alone"`
+	WrapTTL             string   `envconfig:"WRAP_TTL" long:"wrap-ttl" description:"TTL of response wrapped secret_ids and passwords (default: 5m)" vdefault:"5m"`
+	UserpassPasswords   string   `envconfig:"USERPASS_PASSWORD_PATH" long:"userpass-password-path" description:"KV path to store generated userpass passwords at, otherwise they are response wrapped and written to --output"`
+	AuditSkipReenable   bool     `envconfig:"AUDIT_SKIP_REENABLE" long:"audit-skip-reenable" description:"Leave reconfigured audit devices at their temporary path rather than moving them back to the original path"`
+	RotateCreds         bool     `short:"r" long:"rotate-creds" description:"Rotates AWS root credentials" vdefault:"false"`
+	Concurrency         string   `short:"n" long:"concurrent" description:"Number of concurrent threads to run (default: 5)" vdefault:"5"`
+	Environment         string   `envconfig:"VAULT_ADMIN_ENVIRONMENT" short:"e" long:"environment" description:"Environment to use for templates, loads variables from vars/<environment>"`
+	Output              string   `short:"o" long:"output" description:"Output path for commands that write files (schema, convert, render, approle-secret-ids) and wrapped userpass passwords"`
+	Debug               bool     `envconfig:"DEBUG" short:"d" long:"debug" description:"Turn on debug logging"`
+	Version             bool     `short:"v" long:"version" description:"Display the version of the tool"`
 	CurrentVersion      string
 }
 
@@ -63,6 +77,7 @@ func main() {
 	var options GoFlags.Options
 	options = GoFlags.HelpFlag | GoFlags.PassDoubleDash
 	argParser := GoFlags.NewParser(&Spec, options)
+	argParser.Usage = "[OPTIONS] [sync | validate | schema | convert | render | approle-secret-ids | reset-password <auth method path>/<username>...]"
 	retArgs, err := argParser.ParseArgs(os.Args)
 	if err != nil {
 		if len(retArgs) > 0 {
@@ -73,12 +88,21 @@ func main() {
 		}
 	}
 
+	// Mask secrets in all log output
+	log.AddHook(redactHook{})
+
 	// If getting version, do that and exit
 	if Spec.Version {
 		fmt.Println("Vault Admin version: " + Spec.CurrentVersion)
 		return
 	}
 
+	// The first positional argument (after the program name) is the command to run
+	command := "sync"
+	if len(retArgs) > 1 {
+		command = retArgs[1]
+	}
+
 	// Parse environment variables
 	err = envconfig.Process("", &Spec)
 	if err != nil {
@@ -96,7 +120,38 @@ func main() {
 	// Set defaults and ensure required vars are set
 	// We're using custom functions for this because we're using two separate libraries for reading in configuration (args/envs)
 	setDefault(&Spec)
-	checkRequired(&Spec)
+
+	// Remove any temporary configuration directories (i.e. an expanded bundle) when done
+	defer cleanupTempConfigurationDirs()
+
+	// Commands that only work with the configuration files don't need a Vault connection
+	switch command {
+	case "validate":
+		checkRequired(&Spec, false)
+		loadConfigurationBundle()
+		applyConfigurationOverlays()
+		ValidateConfiguration()
+		return
+	case "schema":
+		WriteSchemas()
+		return
+	case "convert":
+		checkRequired(&Spec, false)
+		ConvertConfiguration()
+		return
+	case "render":
+		checkRequired(&Spec, false)
+		loadConfigurationBundle()
+		applyConfigurationOverlays()
+		RenderConfiguration()
+		return
+	case "sync", "approle-secret-ids", "reset-password":
+		checkRequired(&Spec, true)
+		loadConfigurationBundle()
+		applyConfigurationOverlays()
+	default:
+		log.Fatalf("Unknown command [%s]", command)
+	}
 
 	// Configure new Vault Client
 	conf := &VaultApi.Config{Address: Spec.VaultAddress}
@@ -109,7 +164,7 @@ func main() {
 	Spec.VaultToken = ""
 
 	// Print Spec configuration if debugging
-	log.Debug(fmt.Sprintf("%+v", Spec))
+	log.Debug(redactStruct(Spec))
 
 	// Define a Logical Vault client (to read/write values)
 	Vault = VaultClient.Logical()
@@ -122,7 +177,11 @@ func main() {
 	}
 	log.Debug("Vault Health: ", fmt.Sprintf("%+v", health))
 
-	if Spec.RotateCreds {
+	if command == "approle-secret-ids" {
+		IssueAppRoleSecretIDs()
+	} else if command == "reset-password" {
+		ResetUserpassPasswords(retArgs[2:])
+	} else if Spec.RotateCreds {
 		RotateCreds()
 	} else {
 
@@ -144,6 +203,7 @@ func main() {
 		SyncAuditDevices()
 		SyncAuthMethods()
 		SyncPolicies()
+		SyncTokenRoles()
 		SyncSecretsEngines()
 
 		log.Info("Main processing complete - waiting for remaining tasks to complete")
@@ -184,7 +244,9 @@ func setDefault(spec *Specification) {
 	}
 }
 
-func checkRequired(spec *Specification) {
+// checkRequired ensures all fields tagged with vrequired:"true" are set.  Fields
+// tagged with vrequired:"vault" are only required when connecting to Vault
+func checkRequired(spec *Specification, connectToVault bool) {
 
 	t := reflect.TypeOf(*spec)
 
@@ -196,7 +258,7 @@ func checkRequired(spec *Specification) {
 		// Get the field tag value
 		tag := field.Tag.Get("vrequired")
 
-		if tag == "true" && field.Type.Name() != "bool" {
+		if (tag == "true" || (tag == "vault" && connectToVault)) && field.Type.Name() != "bool" {
 			r := reflect.ValueOf(spec)
 			fieldValue := reflect.Indirect(r).FieldByName(field.Name)
 			if fieldValue.String() == "" {
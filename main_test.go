@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	VaultApi "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Options are normally set from the command line and environment, start
+	// from their defaults
+	setDefault(&Spec)
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// writeConfigDir writes a configuration directory containing files (a path
+// relative to the directory -> content) and uses it as the configuration path
+// for the rest of the test
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setSpec(t, &Spec.ConfigurationPath, dir)
+
+	// Template variables are read from the configuration directory once per run
+	templateDataOnce = sync.Once{}
+	t.Cleanup(func() { templateDataOnce = sync.Once{} })
+
+	return dir
+}
+
+// setSpec sets an option for the rest of the test
+func setSpec(t *testing.T, option *string, value string) {
+	t.Helper()
+
+	previous := *option
+	*option = value
+	t.Cleanup(func() { *option = previous })
+}
+
+// testVault is a fake Vault server used as the Vault client for the rest of
+// the test. Reads return Data by path, lists return the keys of Lists by
+// path and writes are stored in Data, with audit devices also added to the
+// sys/audit list. Response wrapped writes return the wrapping token
+// "wrapped-<path>"
+type testVault struct {
+	mutex sync.Mutex
+	Data  map[string]map[string]interface{}
+	Lists map[string][]string
+
+	// Requests made, i.e. "PUT auth/ldap/users/a"
+	Requests []string
+}
+
+func newTestVault(t *testing.T) *testVault {
+	t.Helper()
+
+	v := &testVault{Data: make(map[string]map[string]interface{}), Lists: make(map[string][]string)}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+
+	client, err := VaultApi.NewClient(&VaultApi.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("test-token")
+
+	previousClient, previousVault, previousSys := VaultClient, Vault, VaultSys
+	VaultClient, Vault, VaultSys = client, client.Logical(), client.Sys()
+	t.Cleanup(func() { VaultClient, Vault, VaultSys = previousClient, previousVault, previousSys })
+
+	return v
+}
+
+func (v *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	requestPath := strings.TrimPrefix(r.URL.Path, "/v1/")
+	method := r.Method
+	query := r.URL.Query()
+	if query.Get("list") == "true" {
+		method = "LIST"
+		query.Del("list")
+	}
+	request := method + " " + requestPath
+	if len(query) > 0 {
+		request += "?" + query.Encode()
+	}
+	v.Requests = append(v.Requests, request)
+
+	var response interface{}
+	switch method {
+	case "LIST":
+		if keys, ok := v.Lists[requestPath]; ok {
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": keys}}
+		}
+	case "GET":
+		if data, ok := v.Data[requestPath]; ok {
+			response = map[string]interface{}{"data": data}
+		}
+	case "PUT", "POST":
+		var data map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v.Data[requestPath] = data
+		v.auditDevice(requestPath, data)
+
+		// Response wrapped writes return a wrapping token for the path
+		if r.Header.Get("X-Vault-Wrap-TTL") != "" {
+			response = map[string]interface{}{"wrap_info": map[string]interface{}{
+				"token":         "wrapped-" + requestPath,
+				"accessor":      "accessor-" + requestPath,
+				"ttl":           300,
+				"creation_time": "2020-01-01T00:00:00Z",
+			}}
+			break
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "DELETE":
+		delete(v.Data, requestPath)
+		v.auditDevice(requestPath, nil)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if response == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// auditDevice updates the audit device list (sys/audit) when an audit device
+// is enabled or, with nil data, disabled
+func (v *testVault) auditDevice(requestPath string, data map[string]interface{}) {
+	if !strings.HasPrefix(requestPath, "sys/audit/") {
+		return
+	}
+
+	mountPath := strings.TrimPrefix(requestPath, "sys/audit/") + "/"
+	if v.Data["sys/audit"] == nil {
+		v.Data["sys/audit"] = make(map[string]interface{})
+	}
+	if data == nil {
+		delete(v.Data["sys/audit"], mountPath)
+		return
+	}
+	v.Data["sys/audit"][mountPath] = map[string]interface{}{"type": data["type"], "path": mountPath, "description": data["description"], "options": data["options"]}
+}
+
+// requests returns the requests made with the given method, sorted
+func (v *testVault) requests(method string) []string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	var result []string
+	for _, request := range v.Requests {
+		if strings.HasPrefix(request, method+" ") {
+			result = append(result, strings.TrimPrefix(request, method+" "))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// testTasks collects the tasks queued during a test instead of running them
+type testTasks struct {
+	writes  map[string]taskWrite
+	deletes []string
+}
+
+// captureTasks replaces the task channels for the rest of the test. Call
+// collect once the code under test has queued its tasks
+func captureTasks(t *testing.T) func() testTasks {
+	t.Helper()
+
+	previousTasks, previousPrompts := taskChan, taskPromptChan
+	taskChan = make(chan task, 1000)
+	taskPromptChan = make(chan task, 1000)
+	t.Cleanup(func() { taskChan, taskPromptChan = previousTasks, previousPrompts })
+
+	return func() testTasks {
+		tasks := testTasks{writes: make(map[string]taskWrite)}
+		for {
+			select {
+			case queued := <-taskChan:
+				write, ok := queued.(taskWrite)
+				if !ok {
+					t.Fatalf("Unexpected task %#v", queued)
+				}
+				tasks.writes[write.Path] = write
+				wg.Done()
+			case queued := <-taskPromptChan:
+				switch prompt := queued.(type) {
+				case taskDelete:
+					tasks.deletes = append(tasks.deletes, prompt.Path)
+				case taskDeleteAuditDevice:
+					tasks.deletes = append(tasks.deletes, prompt.Path)
+				default:
+					t.Fatalf("Unexpected prompt task %#v", queued)
+				}
+			default:
+				sort.Strings(tasks.deletes)
+				return tasks
+			}
+		}
+	}
+}
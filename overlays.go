@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Name of the file at the root of an overlay that lists the configuration
+// the overlay removes
+const overlayManifestName = "overlay"
+
+type overlayManifest struct {
+	Remove []string `json:"remove" yaml:"remove"`
+}
+
+// Suffixes (before the extension) of overlay files that patch a file rather
+// than replacing it, i.e. roles/admin.patch.yaml patches roles/admin.json
+const (
+	mergePatchSuffix     = ".patch"
+	strategicPatchSuffix = ".strategic"
+)
+
+// Keys used by strategic patches to match up the items in lists of objects
+var strategicMergeKeys = []string{"name", "username"}
+
+// applyConfigurationOverlays composes the base configuration and the
+// overlays, in order, into a temporary directory which is then used as the
+// configuration
+func applyConfigurationOverlays() {
+	if len(Spec.Overlays) == 0 {
+		return
+	}
+
+	composedDir := newTempConfigurationDir("vault-admin-overlay")
+	labels := make(map[string]string)
+	if err := copyConfigurationDir(Spec.ConfigurationPath, composedDir, labels); err != nil {
+		log.Fatalf("Error reading configuration [%s]: %v", Spec.ConfigurationPath, err)
+	}
+
+	labels[composedDir] = configurationPathLabel(Spec.ConfigurationPath)
+	for _, overlayPath := range Spec.Overlays {
+		log.Infof("Applying overlay [%s]", overlayPath)
+		if err := applyOverlay(overlayPath, composedDir, labels); err != nil {
+			labelConfigurationPaths(labels)
+			log.Fatalf("Error applying overlay [%s]: %v", overlayPath, err)
+		}
+	}
+	labelConfigurationPaths(labels)
+
+	log.Debugf("Configuration composed in [%s]", composedDir)
+	Spec.ConfigurationPath = composedDir
+}
+
+// copyConfigurationDir copies a configuration directory, labelling each copied
+// file with where it came from
+func copyConfigurationDir(srcPath string, dstPath string, labels map[string]string) error {
+	return filepath.Walk(srcPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, _ := filepath.Rel(srcPath, filePath)
+		target := path.Join(dstPath, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		labels[target] = configurationPathLabel(filePath)
+		return ioutil.WriteFile(target, content, 0644)
+	})
+}
+
+// applyOverlay applies an overlay directory to the composed configuration.
+// Configuration listed in the overlay's manifest is removed, patch files are
+// applied to the matching file and any other files are added, replacing the
+// file with the same name
+func applyOverlay(overlayPath string, composedDir string, labels map[string]string) error {
+	manifestPath, hasManifest := findConfigFile(overlayPath, overlayManifestName)
+	if hasManifest {
+		value, err := readRawConfigFile(manifestPath)
+		if err != nil {
+			return err
+		}
+
+		var manifest overlayManifest
+		content, _ := json.Marshal(value)
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return fmt.Errorf("Error parsing overlay manifest [%s]: %v", manifestPath, err)
+		}
+
+		for _, itemPath := range manifest.Remove {
+			if err := removeConfigurationItem(composedDir, itemPath); err != nil {
+				return err
+			}
+			log.Debugf("Overlay [%s] removed [%s]", overlayPath, itemPath)
+		}
+	}
+
+	return filepath.Walk(overlayPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (hasManifest && filePath == manifestPath) {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(overlayPath, filePath)
+		name := fileBaseName(relPath)
+		targetDir := path.Join(composedDir, path.Dir(relPath))
+
+		switch {
+		case strings.HasSuffix(name, mergePatchSuffix):
+			return patchConfigurationFile(filePath, targetDir, strings.TrimSuffix(name, mergePatchSuffix), mergePatch, labels)
+		case strings.HasSuffix(name, strategicPatchSuffix):
+			return patchConfigurationFile(filePath, targetDir, strings.TrimSuffix(name, strategicPatchSuffix), strategicMerge, labels)
+		}
+
+		// Remove the file being replaced, which may have a different extension
+		removeConfigurationFile(path.Join(targetDir, name))
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		target := path.Join(composedDir, relPath)
+		if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+			return err
+		}
+		labels[target] = filePath
+		return ioutil.WriteFile(target, content, 0644)
+	})
+}
+
+// removeConfigurationItem removes a configuration directory, or file by its
+// path without extension (i.e. policies/group-qa)
+func removeConfigurationItem(composedDir string, itemPath string) error {
+	if path.IsAbs(itemPath) || SecretList(strings.Split(itemPath, "/")).Contains("..") {
+		return fmt.Errorf("Invalid path [%s] to remove", itemPath)
+	}
+
+	target := path.Join(composedDir, itemPath)
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return os.RemoveAll(target)
+	}
+
+	if !removeConfigurationFile(target) {
+		return fmt.Errorf("[%s] can't be removed as it does not exist", itemPath)
+	}
+
+	return nil
+}
+
+// removeConfigurationFile removes a configuration file by its path without
+// extension, returning whether there was one
+func removeConfigurationFile(filePath string) bool {
+	removed := false
+	for _, ext := range policyFileExtensions {
+		if err := os.Remove(filePath + ext); err == nil {
+			removed = true
+		}
+	}
+	return removed
+}
+
+// patchConfigurationFile applies a patch file to the configuration file with
+// the given name. Both are parsed as-is, so templates can only be used within
+// strings. The patched file keeps its format
+func patchConfigurationFile(patchPath string, targetDir string, name string, patch func(interface{}, interface{}) interface{}, labels map[string]string) error {
+	target, ok := findConfigFile(targetDir, name)
+	if !ok {
+		return fmt.Errorf("[%s] patches [%s] which does not exist", patchPath, target)
+	}
+
+	targetContent, err := readRawConfigFile(target)
+	if err != nil {
+		return err
+	}
+	patchContent, err := readRawConfigFile(patchPath)
+	if err != nil {
+		return err
+	}
+
+	patched := patch(targetContent, patchContent)
+
+	var content []byte
+	if checkExt(target, ".json") {
+		content, err = json.MarshalIndent(patched, "", "  ")
+		content = append(content, '\n')
+	} else {
+		content, err = yaml.Marshal(patched)
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing patched file [%s]: %v", target, err)
+	}
+
+	labels[target] = fmt.Sprintf("%s (patched by %s)", labels[target], patchPath)
+	return ioutil.WriteFile(target, content, 0644)
+}
+
+// readRawConfigFile reads in a JSON or YAML configuration file without
+// running the template stage
+func readRawConfigFile(filePath string) (interface{}, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file [%s]: %v", filePath, err)
+	}
+
+	jsonContent, err := yamlToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("File [%s] must be valid JSON or YAML before templates are rendered: %v", filePath, err)
+	}
+
+	var value interface{}
+	err = json.Unmarshal(jsonContent, &value)
+	return value, err
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386). Objects are merged, a
+// null removes a field and anything else (including lists) is replaced
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMap, _ := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetMap))
+	for k, v := range targetMap {
+		result[k] = v
+	}
+
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = mergePatch(result[k], v)
+		}
+	}
+
+	return result
+}
+
+// strategicMerge applies a strategic patch. This works like a merge patch
+// except for lists: lists of objects are merged by their name (or username),
+// with "$patch": "delete" removing an item, and lists of values are merged as
+// a set. "$patch": "replace" in an object replaces it instead of merging
+func strategicMerge(target interface{}, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		targetMap, _ := target.(map[string]interface{})
+		if p["$patch"] == "replace" {
+			targetMap = nil
+		}
+
+		result := make(map[string]interface{}, len(targetMap))
+		for k, v := range targetMap {
+			result[k] = v
+		}
+
+		for k, v := range p {
+			if k == "$patch" {
+				continue
+			} else if v == nil {
+				delete(result, k)
+			} else {
+				result[k] = strategicMerge(result[k], v)
+			}
+		}
+
+		return result
+
+	case []interface{}:
+		targetList, ok := target.([]interface{})
+		if !ok {
+			return patch
+		}
+		return strategicMergeList(targetList, p)
+
+	default:
+		return patch
+	}
+}
+
+// strategicMergeList merges two lists for a strategic patch
+func strategicMergeList(target []interface{}, patch []interface{}) []interface{} {
+	key := listMergeKey(append(append([]interface{}{}, target...), patch...))
+	if key == "" {
+		if !isValueList(target) || !isValueList(patch) {
+			return patch
+		}
+
+		result := append([]interface{}{}, target...)
+		for _, item := range patch {
+			if !listContains(result, item) {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+
+	result := append([]interface{}{}, target...)
+	for _, item := range patch {
+		patchItem := item.(map[string]interface{})
+
+		index := -1
+		for i, existing := range result {
+			if existing.(map[string]interface{})[key] == patchItem[key] {
+				index = i
+				break
+			}
+		}
+
+		if patchItem["$patch"] == "delete" {
+			if index >= 0 {
+				result = append(result[:index], result[index+1:]...)
+			}
+		} else if index >= 0 {
+			result[index] = strategicMerge(result[index], patchItem)
+		} else {
+			result = append(result, strategicMerge(nil, patchItem))
+		}
+	}
+
+	return result
+}
+
+// listMergeKey returns the key that all the objects in a list can be matched
+// up by, or an empty string if there isn't one
+func listMergeKey(list []interface{}) string {
+	for _, key := range strategicMergeKeys {
+		found := len(list) > 0
+		for _, item := range list {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if _, ok := m[key]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// isValueList returns whether a list only contains values (not objects or lists)
+func isValueList(list []interface{}) bool {
+	for _, item := range list {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+// listContains returns whether a list of values contains a value
+func listContains(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// decodeJSON decodes a JSON test value
+func decodeJSON(t *testing.T, content string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		t.Fatalf("Invalid test JSON %s: %v", content, err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{name: "fields", target: `{"a": 1, "b": 2}`, patch: `{"b": 3, "c": 4}`, want: `{"a": 1, "b": 3, "c": 4}`},
+		{name: "nested", target: `{"a": {"b": 1, "c": 2}}`, patch: `{"a": {"c": null, "d": 3}}`, want: `{"a": {"b": 1, "d": 3}}`},
+		{name: "lists are replaced", target: `{"a": [1, 2]}`, patch: `{"a": [3]}`, want: `{"a": [3]}`},
+		{name: "null removes", target: `{"a": 1, "b": 2}`, patch: `{"a": null}`, want: `{"b": 2}`},
+		{name: "object replaces value", target: `{"a": "b"}`, patch: `{"a": {"b": 1}}`, want: `{"a": {"b": 1}}`},
+		{name: "non-object patch", target: `{"a": 1}`, patch: `[1]`, want: `[1]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := mergePatch(decodeJSON(t, test.target), decodeJSON(t, test.patch)), decodeJSON(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("mergePatch() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStrategicMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{
+			name:   "objects merged by name",
+			target: `{"roles": [{"name": "a", "ttl": 1, "policies": ["x"]}, {"name": "b", "ttl": 2}]}`,
+			patch:  `{"roles": [{"name": "b", "ttl": 3}, {"name": "c", "ttl": 4}]}`,
+			want:   `{"roles": [{"name": "a", "ttl": 1, "policies": ["x"]}, {"name": "b", "ttl": 3}, {"name": "c", "ttl": 4}]}`,
+		},
+		{
+			name:   "objects merged by username",
+			target: `{"users": [{"username": "a", "policies": ["x"]}]}`,
+			patch:  `{"users": [{"username": "a", "policies": ["y"]}]}`,
+			want:   `{"users": [{"username": "a", "policies": ["x", "y"]}]}`,
+		},
+		{
+			name:   "delete item",
+			target: `{"roles": [{"name": "a"}, {"name": "b"}]}`,
+			patch:  `{"roles": [{"name": "a", "$patch": "delete"}, {"name": "c", "$patch": "delete"}]}`,
+			want:   `{"roles": [{"name": "b"}]}`,
+		},
+		{
+			name:   "values merged as a set",
+			target: `{"policies": ["a", "b"]}`,
+			patch:  `{"policies": ["b", "c"]}`,
+			want:   `{"policies": ["a", "b", "c"]}`,
+		},
+		{
+			name:   "lists without a key are replaced",
+			target: `{"bound_claims": [{"a": 1}]}`,
+			patch:  `{"bound_claims": [{"b": 2}]}`,
+			want:   `{"bound_claims": [{"b": 2}]}`,
+		},
+		{
+			name:   "replace object",
+			target: `{"config": {"a": 1, "b": 2}}`,
+			patch:  `{"config": {"$patch": "replace", "c": 3}}`,
+			want:   `{"config": {"c": 3}}`,
+		},
+		{
+			name:   "null removes",
+			target: `{"a": 1, "b": 2}`,
+			patch:  `{"a": null}`,
+			want:   `{"b": 2}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := strategicMerge(decodeJSON(t, test.target), decodeJSON(t, test.patch)), decodeJSON(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("strategicMerge() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyOverlay(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"base/policies/admin.hcl":               "path \"*\" {}\n",
+		"base/policies/dev.json":                `{"path": {}}`,
+		"base/auth_methods/ldap.json":           `{"type": "ldap", "additional_config": {"config": {"url": "ldap://dev"}}}`,
+		"base/token_roles/ci.yaml":              "allowed_policies: [ci]\n",
+		"overlay/overlay.yaml":                  "remove: [policies/dev]\n",
+		"overlay/policies/admin.yaml":           "path:\n  secret/*: {}\n",
+		"overlay/auth_methods/ldap.patch.yml":   "additional_config:\n  config:\n    url: ldap://prod\n",
+		"overlay/token_roles/ci.strategic.yaml": "allowed_policies: [deploy]\n",
+	})
+
+	composedDir := t.TempDir()
+	labels := make(map[string]string)
+	if err := copyConfigurationDir(filepath.Join(dir, "base"), composedDir, labels); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyOverlay(filepath.Join(dir, "overlay"), composedDir, labels); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"policies/admin.yaml":    "path:\n  secret/*: {}\n",
+		"auth_methods/ldap.json": "{\n  \"additional_config\": {\n    \"config\": {\n      \"url\": \"ldap://prod\"\n    }\n  },\n  \"type\": \"ldap\"\n}\n",
+		"token_roles/ci.yaml":    "allowed_policies:\n    - ci\n    - deploy\n",
+	}
+	got := make(map[string]string)
+	filepath.Walk(composedDir, func(filePath string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			content, _ := ioutil.ReadFile(filePath)
+			relPath, _ := filepath.Rel(composedDir, filePath)
+			got[relPath] = string(content)
+		}
+		return err
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyOverlay() = %q, want %q", got, want)
+	}
+}
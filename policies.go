@@ -2,15 +2,21 @@ package main
 
 import (
 	"fmt"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
 	"path"
 )
 
 type Policy struct {
-	Name           string `json:"name",yaml:"name"`
-	PolicyDocument string `json:"policy",yaml:"policy"`
+	Name           string `json:"name" yaml:"name"`
+	PolicyDocument string `json:"policy" yaml:"policy"`
 }
 
+// Extensions of files that can be used for policies. HCL policies are sent to
+// Vault as-is, the others are converted to JSON
+var policyFileExtensions = append([]string{".hcl"}, configFileExtensions...)
+
 var policyList SecretList
 
 func SyncPolicies() {
@@ -18,7 +24,7 @@ func SyncPolicies() {
 	log.Info("Syncing Policies")
 
 	// Create/Update Policies
-	rawPolicies := processDirectoryRaw(path.Join(Spec.ConfigurationPath, "policies"))
+	rawPolicies := processPolicyDirectory(path.Join(Spec.ConfigurationPath, "policies"))
 	for policyName, rawPolicyDocument := range rawPolicies {
 		policy := Policy{Name: policyName, PolicyDocument: string(rawPolicyDocument)}
 		policyPath := path.Join("sys/policies/acl", policy.Name)
@@ -50,3 +56,70 @@ func SyncPolicies() {
 		}
 	}
 }
+
+// processPolicyDirectory reads in all the policy files in a directory and its
+// subdirectories, keyed by the policy name (i.e. team/app/read)
+func processPolicyDirectory(dirPath string) map[string][]byte {
+
+	results := make(map[string][]byte)
+
+	for _, entry := range loadConfigDirectory(dirPath, isPolicyFile, false) {
+		fileContent, err := readPolicyFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results[entry.Name] = fileContent
+	}
+
+	return results
+}
+
+// readPolicyFile reads in a policy file. HCL policies are parsed to catch
+// syntax errors before they are uploaded
+func readPolicyFile(filePath string) ([]byte, error) {
+	if !checkExt(filePath, ".hcl") {
+		return readConfigFile(filePath)
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file [%s]: %v", filePath, err)
+	}
+
+	content, err = renderTemplate(filePath, content)
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering template [%s]: %v", filePath, err)
+	}
+
+	if line, err := parsePolicyHCL(content); err != nil {
+		return nil, fmt.Errorf("Policy [%s] is not valid HCL [%s:%d]: %v", fileBaseName(filePath), filePath, line, err)
+	}
+
+	return content, nil
+}
+
+// parsePolicyHCL checks the syntax of an HCL policy, returning the line of
+// the error if there is one
+func parsePolicyHCL(content []byte) (int, error) {
+	_, err := hclParser.Parse(content)
+	if err == nil {
+		return 0, nil
+	}
+
+	if posErr, ok := err.(*hclParser.PosError); ok {
+		return posErr.Pos.Line, posErr.Err
+	}
+
+	return 0, err
+}
+
+// isPolicyFile returns whether the file has one of the policy file extensions
+func isPolicyFile(filename string) bool {
+	for _, ext := range policyFileExtensions {
+		if checkExt(filename, ext) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicyHCL(t *testing.T) {
+	tests := []struct {
+		name     string
+		hcl      string
+		wantLine int
+		wantErr  bool
+	}{
+		{
+			name: "valid",
+			hcl:  "path \"secret/*\" {\n  capabilities = [\"read\", \"list\"]\n}\n",
+		},
+		{
+			name: "comments",
+			hcl:  "# Read secrets\npath \"secret/*\" {\n  // Only read\n  capabilities = [\"read\"]\n}\n",
+		},
+		{
+			name:     "unclosed block",
+			hcl:      "path \"secret/*\" {\n  capabilities = [\"read\"]\n",
+			wantLine: 3,
+			wantErr:  true,
+		},
+		{
+			name:     "extra closing brace",
+			hcl:      "path \"secret/*\" {\n  capabilities = [\"read\"]\n}\n}\n",
+			wantLine: 4,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, err := parsePolicyHCL([]byte(test.hcl))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parsePolicyHCL() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if line != test.wantLine {
+				t.Errorf("parsePolicyHCL() line = %d, want %d", line, test.wantLine)
+			}
+		})
+	}
+}
+
+func TestReadPolicyFile(t *testing.T) {
+	hcl := "path \"secret/*\" {\n  capabilities = [\"read\"]\n}\n"
+	dir := writeConfigDir(t, map[string]string{
+		"policies/read.hcl":   hcl,
+		"policies/broken.hcl": "path \"secret/*\" {\n",
+		"policies/read.yaml":  "path:\n  secret/*:\n    capabilities: [read]\n",
+	})
+
+	tests := []struct {
+		file    string
+		want    string
+		wantErr string
+	}{
+		// HCL policies are uploaded as-is
+		{file: "read.hcl", want: hcl},
+		{file: "read.yaml", want: `{"path":{"secret/*":{"capabilities":["read"]}}}`},
+		{file: "broken.hcl", wantErr: "Policy [broken] is not valid HCL [" + filepath.Join(dir, "policies/broken.hcl") + ":2]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := readPolicyFile(filepath.Join(dir, "policies", test.file))
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Fatalf("readPolicyFile() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("readPolicyFile() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Replacement for redacted values
+const redactedValue = "********"
+
+// Values shorter than this aren't registered for redaction since masking them
+// everywhere (i.e. "true" or "10") would make logs unreadable
+const minRedactedLength = 4
+
+// Fields that contain sensitive values, matched case insensitively against
+// configuration keys
+var sensitiveFields = SecretList{"password", "secret_key", "bindpass", "client_secret", "token", "secret_id", "private_key", "access_key", "oidc_client_secret", "token_reviewer_jwt", "api_token", "secret"}
+
+// secretValues holds the values that have been substituted into the
+// configuration. These are masked wherever they appear in the logs
+var secretValues = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: make(map[string]bool)}
+
+// registerSecretValue marks a value as sensitive. Lists and maps (from typed
+// substitutions) have all their values registered. Values containing
+// placeholders are skipped so they can still be reported if not found
+func registerSecretValue(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if len(v) >= minRedactedLength && !substitutionRegex.MatchString(v) && !isTypedPlaceholder(v) {
+			secretValues.Lock()
+			secretValues.values[v] = true
+			secretValues.Unlock()
+		}
+	case []interface{}:
+		for _, item := range v {
+			registerSecretValue(item)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			registerSecretValue(item)
+		}
+	}
+}
+
+// registerSensitiveFields registers the values of all the sensitive fields in
+// a configuration map
+func registerSensitiveFields(data map[string]interface{}) {
+	for k, v := range data {
+		if isSensitiveField(k) {
+			registerSecretValue(v)
+		} else {
+			registerNestedSensitiveFields(v)
+		}
+	}
+}
+
+// registerNestedSensitiveFields registers the sensitive fields of the maps
+// within a configuration value (i.e. a list of roles)
+func registerNestedSensitiveFields(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		registerSensitiveFields(v)
+	case []interface{}:
+		for _, item := range v {
+			registerNestedSensitiveFields(item)
+		}
+	}
+}
+
+// registerConfigSensitiveFields registers the sensitive fields of a
+// configuration file as it is loaded, so they are masked from the start of the
+// run rather than only once they are written
+func registerConfigSensitiveFields(content []byte) {
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return
+	}
+	registerNestedSensitiveFields(value)
+}
+
+// redactString masks all the registered secret values within s
+func redactString(s string) string {
+	secretValues.RLock()
+	defer secretValues.RUnlock()
+
+	if len(secretValues.values) == 0 {
+		return s
+	}
+
+	// Replace the longest values first in case one value contains another
+	values := make([]string, 0, len(secretValues.values))
+	for value := range secretValues.values {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, value := range values {
+		s = strings.Replace(s, value, redactedValue, -1)
+	}
+
+	return s
+}
+
+// isSensitiveField returns whether a configuration key holds a sensitive value
+func isSensitiveField(name string) bool {
+	return sensitiveFields.Contains(strings.ToLower(name))
+}
+
+// redactStruct formats a struct for printing with the fields tagged with
+// redact:"true" masked
+func redactStruct(item interface{}) string {
+	v := reflect.ValueOf(item)
+	t := v.Type()
+
+	fields := make([]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		value := fmt.Sprintf("%v", v.Field(i).Interface())
+		if t.Field(i).Tag.Get("redact") == "true" && value != "" {
+			value = redactedValue
+		}
+		fields[i] = fmt.Sprintf("%s:%s", t.Field(i).Name, redactString(value))
+	}
+
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+// maskIdentifier masks all but the last four characters of a value, keeping
+// enough to tell values (i.e. access keys) apart without revealing them
+func maskIdentifier(value string) string {
+	if len(value) <= 8 {
+		return redactedValue
+	}
+	return redactedValue + value[len(value)-4:]
+}
+
+// redactHook is a logrus hook that masks the registered secret values in
+// every log message and field
+type redactHook struct{}
+
+func (h redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h redactHook) Fire(entry *log.Entry) error {
+	entry.Message = redactString(entry.Message)
+	for k, v := range entry.Data {
+		if isSensitiveField(k) {
+			entry.Data[k] = redactedValue
+		} else if s, ok := v.(string); ok {
+			entry.Data[k] = redactString(s)
+		}
+	}
+	return nil
+}
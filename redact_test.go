@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// resetSecretValues clears the registered secret values for a test
+func resetSecretValues(t *testing.T) {
+	secretValues.values = make(map[string]bool)
+	t.Cleanup(func() { secretValues.values = make(map[string]bool) })
+}
+
+func TestRedactString(t *testing.T) {
+	resetSecretValues(t)
+	registerSecretValue("hunter2")
+	registerSecretValue("hunter2-longer")
+	registerSecretValue([]interface{}{"list-secret", map[string]interface{}{"key": "map-secret"}})
+	registerSecretValue("abc")
+	registerSecretValue("%{env:PASSWORD}%")
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "password is hunter2", want: "password is ********"},
+		// The longest value is replaced first
+		{value: "hunter2-longer", want: "********"},
+		{value: "list-secret and map-secret", want: "******** and ********"},
+		// Short values and placeholders aren't registered
+		{value: "abc", want: "abc"},
+		{value: "%{env:PASSWORD}% not found", want: "%{env:PASSWORD}% not found"},
+	}
+
+	for _, test := range tests {
+		if got := redactString(test.value); got != test.want {
+			t.Errorf("redactString(%s) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestRegisterConfigSensitiveFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "top level",
+			content: `{"binddn": "cn=admin", "bindpass": "ldap-password", "url": "ldap://example"}`,
+			want:    []string{"ldap-password"},
+		},
+		{
+			name:    "nested",
+			content: `{"roles": [{"name": "a", "secret_id": "role-secret"}], "config": {"Password": "nested-password"}}`,
+			want:    []string{"nested-password", "role-secret"},
+		},
+		{
+			name:    "placeholders",
+			content: `{"bindpass": "%{BINDPASS}%", "token": "%[TOKEN]%", "password": "prefix-%{sops:PASSWORD}%"}`,
+		},
+		{
+			name:    "public keys",
+			content: `{"jwt_validation_pubkeys": ["-----BEGIN PUBLIC KEY-----"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetSecretValues(t)
+			registerConfigSensitiveFields([]byte(test.content))
+
+			var got []string
+			for value := range secretValues.values {
+				got = append(got, value)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("registerConfigSensitiveFields() registered %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileRegistersSensitiveFields(t *testing.T) {
+	resetSecretValues(t)
+	dir := writeConfigDir(t, map[string]string{"auth_methods/ldap.yaml": "additional_config:\n  config:\n    bindpass: yaml-password\n"})
+
+	if _, err := readConfigFile(dir + "/auth_methods/ldap.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if got := redactString("bind with yaml-password"); got != "bind with ********" {
+		t.Errorf("redactString() = %s, want the password masked once the configuration is read", got)
+	}
+}
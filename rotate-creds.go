@@ -13,7 +13,7 @@ func RotateCreds() {
 			if err != nil {
 				log.Warn("Cannot rotate ["+path+"] ", err)
 			} else {
-				log.Info("Rotated key for ["+path+"].  New access key: ", secret.Data["access_key"].(string))
+				log.Info("Rotated key for ["+path+"].  New access key: ", maskIdentifier(secret.Data["access_key"].(string)))
 			}
 		}
 	}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	VaultApi "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is a JSON Schema (draft-07) document or sub-schema
+type jsonSchema map[string]interface{}
+
+// configSchema is the JSON Schema for one type of configuration file
+type configSchema struct {
+	// Name of the schema, also used for the name of the written file
+	Name string
+
+	// Files this schema applies to, relative to the configuration path
+	Files []string
+
+	Schema jsonSchema
+}
+
+// schemaTypeOverrides are used for types that can't be described by reflecting
+// on their fields (i.e. they have custom JSON marshalling)
+var schemaTypeOverrides = map[reflect.Type]jsonSchema{
+	reflect.TypeOf(duration(0)): durationSchema,
+}
+
+// Values that Vault accepts as either a list or a comma separated string
+var stringListSchema = jsonSchema{"type": []interface{}{"string", "array"}, "items": jsonSchema{"type": "string"}}
+
+// Values that Vault accepts as either a duration string or a number of seconds
+var ttlSchema = jsonSchema{"type": []interface{}{"string", "integer"}}
+
+// Values of the duration type, which is parsed before being sent to Vault.
+// Durations are TTLs that can't be negative, unless the schema uses
+// signedDurationSchema
+var durationSchema = jsonSchema{
+	"type":        []interface{}{"string", "integer"},
+	"pattern":     nonNegativeDurationPattern,
+	"minimum":     0,
+	"description": "a number of seconds or a duration string (i.e. 1h, 30m or 7d)",
+}
+
+// Durations that can be negative, i.e. -1 to disable the JWT/OIDC leeways
+var signedDurationSchema = jsonSchema{
+	"type":        []interface{}{"string", "integer"},
+	"pattern":     durationPattern,
+	"description": "a number of seconds or a duration string (i.e. 1h, 30m, 7d or -1)",
+}
+
+// configSchemas contains the schemas for every type of configuration file
+var configSchemas = buildConfigSchemas()
+
+// WriteSchemas writes out all the configuration file schemas as
+// <name>.schema.json to the output directory
+func WriteSchemas() {
+
+	outputPath := Spec.Output
+	if outputPath == "" {
+		outputPath = "."
+	}
+
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		log.Fatalf("Unable to create schema output directory [%s]: %v", outputPath, err)
+	}
+
+	for _, s := range configSchemas {
+		content, err := json.MarshalIndent(s.Schema, "", "  ")
+		if err != nil {
+			log.Fatalf("Unable to marshall schema [%s]: %v", s.Name, err)
+		}
+
+		schemaPath := path.Join(outputPath, s.Name+".schema.json")
+		if err := ioutil.WriteFile(schemaPath, append(content, '\n'), 0644); err != nil {
+			log.Fatalf("Unable to write schema [%s]: %v", schemaPath, err)
+		}
+		log.Infof("Schema for [%s] written to [%s]", strings.Join(s.Files, ", "), schemaPath)
+	}
+}
+
+// getConfigSchema returns the schema with the given name
+func getConfigSchema(name string) jsonSchema {
+	for _, s := range configSchemas {
+		if s.Name == name {
+			return s.Schema
+		}
+	}
+
+	log.Fatalf("Unknown configuration schema [%s]", name)
+	return nil
+}
+
+// warnUnknownFields logs a warning for each field of a decoded configuration
+// item that isn't in its schema, as these are ignored
+func warnUnknownFields(value interface{}, schemaName string, description string) {
+	for _, e := range validateSchema(getConfigSchema(schemaName), value, nil) {
+		if e.Warning {
+			log.Warnf("%s: %s", description, e.Message)
+		}
+	}
+}
+
+func buildConfigSchemas() []configSchema {
+
+	auditDevice := schemaFromType(reflect.TypeOf(AuditDevice{}))
+	auditDevice.require("type")
+	auditDevice.property("options")["additionalProperties"] = jsonSchema{"type": []interface{}{"string", "boolean", "number"}}
+	auditDevice.property("type")["enum"] = stringsToInterfaces(knownAuditDeviceTypes)
+
+	auth := schemaFromType(reflect.TypeOf(authMethod{}))
+	auth.require("auth_options")
+	auth.property("auth_options").require("type")
+	auth["allOf"] = []interface{}{
+		authMethodTypeSchema([]string{"userpass"}, userpassAdditionalConfigSchema(), true),
+		authMethodTypeSchema([]string{"ldap"}, ldapAdditionalConfigSchema(), true),
+		authMethodTypeSchema([]string{"jwt", "oidc"}, jwtAdditionalConfigSchema(), false),
+		authMethodTypeSchema([]string{"approle"}, authRolesAdditionalConfigSchema(appRoleSchema()), false),
+		authMethodTypeSchema([]string{"kubernetes"}, authRolesAdditionalConfigSchema(kubernetesRoleSchema()), false),
+		authMethodTypeSchema([]string{"aws"}, awsAuthAdditionalConfigSchema(), false),
+		authMethodTypeSchema([]string{"github"}, schemaFromType(reflect.TypeOf(AuthMethodGitHubAdditionalConfig{})), false),
+		authMethodTypeSchema([]string{"okta"}, schemaFromType(reflect.TypeOf(AuthMethodOktaAdditionalConfig{})), false),
+		authMethodTypeSchema([]string{"radius"}, schemaFromType(reflect.TypeOf(AuthMethodRADIUSAdditionalConfig{})), false),
+	}
+
+	secretsEngine := schemaFromType(reflect.TypeOf(VaultApi.MountInput{}))
+	secretsEngine.require("type")
+
+	awsRole := schemaFromType(reflect.TypeOf(awsRoleEntry{}))
+	awsRole.require("credential_type")
+	awsRole.property("credential_type")["enum"] = stringsToInterfaces(awsCredentialTypes)
+	awsRole.allowExtends()
+
+	entity := schemaFromType(reflect.TypeOf(EntityConfig{}))
+	entity.property("entity-aliases", "items").require("name")
+
+	group := schemaFromType(reflect.TypeOf(GroupConfig{}))
+	group.property("group", "type")["enum"] = []interface{}{"internal", "external"}
+	group.property("group-alias").require("name")
+	group.allowExtends()
+
+	schemas := []configSchema{
+		{Name: "audit-device", Files: []string{"audit_devices/*"}, Schema: auditDevice},
+		{Name: "auth-method", Files: []string{"auth_methods/*"}, Schema: auth},
+		{Name: "auth-approle-role", Files: []string{"auth_methods/*/roles/*"}, Schema: appRoleSchema()},
+		{Name: "auth-kubernetes-role", Files: []string{"auth_methods/*/roles/*"}, Schema: kubernetesRoleSchema()},
+		{Name: "auth-jwt-role", Files: []string{"auth_methods/*/roles/*"}, Schema: jwtRoleFileSchema()},
+		{Name: "auth-aws-role", Files: []string{"auth_methods/*/roles/*"}, Schema: awsAuthRoleSchema()},
+		{Name: "auth-cert", Files: []string{"auth_methods/*/certs/*"}, Schema: schemaFromType(reflect.TypeOf(certRole{}))},
+		{Name: "policy", Files: []string{"policies/*"}, Schema: policySchema()},
+		{Name: "token-role", Files: []string{"token_roles/*"}, Schema: tokenRoleSchema()},
+		{Name: "secrets-engine", Files: []string{"secrets-engines/*/config.*"}, Schema: secretsEngine},
+		{Name: "secrets-engine-aws", Files: []string{"secrets-engines/*/aws.*"}, Schema: schemaFromType(reflect.TypeOf(SecretsEngineAWS{}))},
+		{Name: "secrets-engine-aws-role", Files: []string{"secrets-engines/*/roles/*"}, Schema: awsRole},
+		{Name: "secrets-engine-database", Files: []string{"secrets-engines/*/db.*"}, Schema: databaseConfigSchema()},
+		{Name: "secrets-engine-database-role", Files: []string{"secrets-engines/*/roles/*"}, Schema: databaseRoleSchema()},
+		{Name: "identity-entity", Files: []string{"secrets-engines/identity/entities/*"}, Schema: entity},
+		{Name: "identity-group", Files: []string{"secrets-engines/identity/groups/*"}, Schema: group},
+	}
+
+	for _, s := range schemas {
+		s.Schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+		s.Schema["title"] = fmt.Sprintf("vault-admin %s configuration (%s)", strings.Replace(s.Name, "-", " ", -1), strings.Join(s.Files, ", "))
+	}
+
+	return schemas
+}
+
+// authMethodTypeSchema applies an additional_config schema to auth methods of the given types
+func authMethodTypeSchema(authTypes []string, additionalConfig jsonSchema, required bool) jsonSchema {
+	then := jsonSchema{"properties": jsonSchema{"additional_config": additionalConfig}}
+	if required {
+		then.require("additional_config")
+	}
+
+	return jsonSchema{
+		"if": jsonSchema{
+			"properties": jsonSchema{
+				"auth_options": jsonSchema{
+					"properties": jsonSchema{"type": jsonSchema{"enum": stringsToInterfaces(authTypes)}},
+					"required":   []interface{}{"type"},
+				},
+			},
+			"required": []interface{}{"auth_options"},
+		},
+		"then": then,
+	}
+}
+
+func userpassAdditionalConfigSchema() jsonSchema {
+	return jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"users": jsonSchema{
+				"type": "array",
+				"items": jsonSchema{
+					"type": "object",
+					"properties": jsonSchema{
+						"username":       jsonSchema{"type": "string", "minLength": 1},
+						"password":       jsonSchema{"type": "string"},
+						"policies":       stringListSchema,
+						"token_policies": stringListSchema,
+						"bound_cidrs":    stringListSchema,
+						"ttl":            ttlSchema,
+						"max_ttl":        ttlSchema,
+					},
+					"required": []interface{}{"username"},
+				},
+			},
+		},
+		"required": []interface{}{"users"},
+	}
+}
+
+func ldapAdditionalConfigSchema() jsonSchema {
+
+	// Group or user names mapped to policies or groups
+	ldapNameMap := jsonSchema{
+		"type":                 "object",
+		"additionalProperties": jsonSchema{"type": "array", "items": jsonSchema{"type": "string"}},
+	}
+
+	return jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"policy_map":      ldapNameMap,
+			"user_policy_map": ldapNameMap,
+			"user_group_map":  ldapNameMap,
+		},
+		"required": []interface{}{"policy_map"},
+	}
+}
+
+func jwtAdditionalConfigSchema() jsonSchema {
+	role := jwtRoleSchema()
+	s := authRolesAdditionalConfigSchema(role)
+	role.allowExtends()
+	return s
+}
+
+// jwtRoleFileSchema describes a JWT/OIDC role in its own file
+func jwtRoleFileSchema() jsonSchema {
+	s := jwtRoleSchema()
+	s.allowExtends()
+	return s
+}
+
+func jwtRoleSchema() jsonSchema {
+	s := schemaFromType(reflect.TypeOf(jwtRole{}))
+	s.property("role_type")["enum"] = []interface{}{"", "jwt", "oidc"}
+	s.property("bound_claims_type")["enum"] = []interface{}{"", "string", "glob"}
+	s.property("callback_mode")["enum"] = []interface{}{"", "client", "direct", "device"}
+	s.property("token_type")["enum"] = []interface{}{"", "service", "batch", "default", "default-service", "default-batch"}
+	for _, name := range []string{"clock_skew_leeway", "expiration_leeway", "not_before_leeway"} {
+		s["properties"].(jsonSchema)[name] = signedDurationSchema
+	}
+	return s
+}
+
+// authRolesAdditionalConfigSchema describes the additional_config of auth
+// methods with a list of roles
+func authRolesAdditionalConfigSchema(role jsonSchema) jsonSchema {
+	role.require("name")
+	role.property("name")["minLength"] = 1
+	return jsonSchema{
+		"type":       "object",
+		"properties": jsonSchema{"roles": jsonSchema{"type": "array", "items": role}},
+	}
+}
+
+// appRoleSchema describes an AppRole role, TTLs can be seconds or a duration string
+func appRoleSchema() jsonSchema {
+	s := schemaFromType(reflect.TypeOf(appRole{}))
+	s.property("secret_id_ttl")["type"] = ttlSchema["type"]
+	return s
+}
+
+func kubernetesRoleSchema() jsonSchema {
+	s := schemaFromType(reflect.TypeOf(kubernetesRole{}))
+	s.property("alias_name_source")["enum"] = []interface{}{"serviceaccount_uid", "serviceaccount_name"}
+	return s
+}
+
+func awsAuthRoleSchema() jsonSchema {
+	s := schemaFromType(reflect.TypeOf(awsAuthRole{}))
+	s.property("auth_type")["enum"] = []interface{}{"ec2", "iam"}
+	s.property("inferred_entity_type")["enum"] = []interface{}{"", "ec2_instance"}
+	return s
+}
+
+// awsAuthAdditionalConfigSchema adds the STS roles and tidy settings to the
+// AWS auth method's roles
+func awsAuthAdditionalConfigSchema() jsonSchema {
+	s := authRolesAdditionalConfigSchema(awsAuthRoleSchema())
+	config := schemaFromType(reflect.TypeOf(AuthMethodAWSAdditionalConfig{}))
+	config.property("sts", "items").require("account_id", "sts_role")
+	for _, name := range []string{"identity_whitelist", "roletag_blacklist"} {
+		config.property(name, "safety_buffer")["type"] = ttlSchema["type"]
+		s["properties"].(jsonSchema)[name] = config.property(name)
+	}
+	s["properties"].(jsonSchema)["sts"] = config.property("sts")
+	return s
+}
+
+func tokenRoleSchema() jsonSchema {
+	s := schemaFromType(reflect.TypeOf(TokenRole{}))
+	s.property("token_type")["enum"] = []interface{}{"service", "batch", "default-service", "default-batch"}
+	return s
+}
+
+// policySchema describes a Vault ACL policy in its JSON form
+func policySchema() jsonSchema {
+	parameters := jsonSchema{"type": "object", "additionalProperties": jsonSchema{"type": "array"}}
+	return jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"path": jsonSchema{
+				"type": "object",
+				"additionalProperties": jsonSchema{
+					"type": "object",
+					"properties": jsonSchema{
+						"capabilities": jsonSchema{
+							"type":  "array",
+							"items": jsonSchema{"enum": []interface{}{"create", "read", "update", "delete", "list", "sudo", "deny"}},
+						},
+						"allowed_parameters":  parameters,
+						"denied_parameters":   parameters,
+						"required_parameters": jsonSchema{"type": "array", "items": jsonSchema{"type": "string"}},
+						"min_wrapping_ttl":    ttlSchema,
+						"max_wrapping_ttl":    ttlSchema,
+						"control_group":       jsonSchema{"type": "object"},
+					},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []interface{}{"path"},
+		"additionalProperties": false,
+	}
+}
+
+// databaseConfigSchema describes the database connection (db.json). Plugins
+// accept their own parameters so additional properties are allowed
+func databaseConfigSchema() jsonSchema {
+	return jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"plugin_name":              jsonSchema{"type": "string", "minLength": 1},
+			"connection_url":           jsonSchema{"type": "string"},
+			"username":                 jsonSchema{"type": "string"},
+			"password":                 jsonSchema{"type": "string"},
+			"verify_connection":        jsonSchema{"type": "boolean"},
+			"allowed_roles":            stringListSchema,
+			"root_rotation_statements": stringListSchema,
+			"max_open_connections":     jsonSchema{"type": []interface{}{"string", "integer"}},
+			"max_idle_connections":     jsonSchema{"type": []interface{}{"string", "integer"}},
+			"max_connection_lifetime":  ttlSchema,
+		},
+		"required": []interface{}{"plugin_name"},
+	}
+}
+
+func databaseRoleSchema() jsonSchema {
+	s := jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"db_name":               jsonSchema{"type": "string", "minLength": 1},
+			"creation_statements":   stringListSchema,
+			"revocation_statements": stringListSchema,
+			"rollback_statements":   stringListSchema,
+			"renew_statements":      stringListSchema,
+			"default_ttl":           ttlSchema,
+			"max_ttl":               ttlSchema,
+		},
+		"required":             []interface{}{"db_name", "creation_statements"},
+		"additionalProperties": false,
+	}
+	s.allowExtends()
+	return s
+}
+
+// schemaFromType generates a schema from a Go type using its json tags.
+// Struct fields without a json tag are set internally (i.e. from the filename)
+// and are not part of the schema
+func schemaFromType(t reflect.Type) jsonSchema {
+
+	if override, ok := schemaTypeOverrides[t]; ok {
+		s := jsonSchema{}
+		for k, v := range override {
+			s[k] = v
+		}
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFromType(t.Elem())
+	case reflect.Struct:
+		properties := jsonSchema{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			// Fields of embedded structs are part of the parent object
+			if field.Anonymous && name == "" {
+				for k, v := range schemaFromType(field.Type)["properties"].(jsonSchema) {
+					properties[k] = v
+				}
+				continue
+			}
+
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = schemaFromType(field.Type)
+		}
+		return jsonSchema{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Slice, reflect.Array:
+		return jsonSchema{"type": "array", "items": schemaFromType(t.Elem())}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": schemaFromType(t.Elem())}
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	}
+
+	// Anything else (i.e. interface{}) can be any value
+	return jsonSchema{}
+}
+
+// property returns a nested sub-schema. Names are looked up in "properties"
+// except for "items" which returns the schema of array items
+func (s jsonSchema) property(names ...string) jsonSchema {
+	for _, name := range names {
+		var next interface{}
+		if name == "items" {
+			next = s["items"]
+		} else if properties, ok := s["properties"].(jsonSchema); ok {
+			next = properties[name]
+		}
+
+		sub, ok := next.(jsonSchema)
+		if !ok {
+			log.Fatalf("Schema property [%s] not found", strings.Join(names, "."))
+		}
+		s = sub
+	}
+	return s
+}
+
+// allowExtends adds the extends field to the schema of an item that can
+// extend templates. Items are checked once their templates are merged in, so
+// required fields can come from the item or any template it extends
+func (s jsonSchema) allowExtends() {
+	s["properties"].(jsonSchema)["extends"] = stringListSchema
+}
+
+// require marks fields as required
+func (s jsonSchema) require(names ...string) {
+	required, _ := s["required"].([]interface{})
+	for _, name := range names {
+		required = append(required, name)
+	}
+	s["required"] = required
+}
+
+// schemaError is a single problem found when validating against a schema
+type schemaError struct {
+	Path    []interface{}
+	Message string
+
+	// Warnings are for issues that won't cause a failure (i.e. unknown fields
+	// that are ignored)
+	Warning bool
+}
+
+// validateSchema validates a decoded JSON value against a schema. Only the
+// subset of JSON Schema used by the configuration schemas is supported
+func validateSchema(s jsonSchema, value interface{}, valuePath []interface{}) []schemaError {
+
+	var errors []schemaError
+	fail := func(format string, args ...interface{}) {
+		errors = append(errors, schemaError{Path: valuePath, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Typed placeholders are substituted during a sync so can be any type
+	if str, ok := value.(string); ok && isTypedPlaceholder(str) {
+		return nil
+	}
+
+	if schemaType, ok := s["type"]; ok && !schemaTypeMatches(schemaType, value) {
+		fail("Invalid value for '%s': expected %s but got %s", schemaPathString(valuePath), schemaTypeString(schemaType), jsonTypeName(value))
+		return errors
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+			}
+		}
+		if !found {
+			fail("Invalid value [%v] for '%s', must be one of: %v", value, schemaPathString(valuePath), enum)
+		}
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		if str, ok := value.(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			if description, ok := s["description"].(string); ok {
+				fail("Invalid value [%s] for '%s', expected %s", str, schemaPathString(valuePath), description)
+			} else {
+				fail("Invalid value [%s] for '%s'", str, schemaPathString(valuePath))
+			}
+		}
+	}
+
+	if minimum, ok := s["minimum"].(int); ok {
+		if number, ok := value.(float64); ok && number < float64(minimum) {
+			fail("Invalid value [%v] for '%s', must be at least %d", number, schemaPathString(valuePath), minimum)
+		}
+	}
+
+	if minLength, ok := s["minLength"].(int); ok {
+		if str, ok := value.(string); ok && len(str) < minLength {
+			fail("'%s' must not be empty", schemaPathString(valuePath))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := s["properties"].(jsonSchema)
+
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					fail("Missing required field '%s'", schemaPathString(append(copyPath(valuePath), name)))
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := append(copyPath(valuePath), key)
+			if propertySchema, ok := properties[key].(jsonSchema); ok {
+				errors = append(errors, validateSchema(propertySchema, v[key], keyPath)...)
+			} else if additional, ok := s["additionalProperties"].(jsonSchema); ok {
+				errors = append(errors, validateSchema(additional, v[key], keyPath)...)
+			} else if additional, ok := s["additionalProperties"].(bool); ok && !additional {
+				errors = append(errors, schemaError{Path: keyPath, Message: fmt.Sprintf("Unknown field '%s' will be ignored", schemaPathString(keyPath)), Warning: true})
+			}
+		}
+	case []interface{}:
+		if items, ok := s["items"].(jsonSchema); ok {
+			for i, item := range v {
+				errors = append(errors, validateSchema(items, item, append(copyPath(valuePath), i))...)
+			}
+		}
+	}
+
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			errors = append(errors, validateSchema(sub.(jsonSchema), value, valuePath)...)
+		}
+	}
+
+	// The "then" schema only applies when the value validates against "if",
+	// otherwise the "else" schema applies
+	if ifSchema, ok := s["if"].(jsonSchema); ok {
+		if !hasSchemaErrors(validateSchema(ifSchema, value, valuePath)) {
+			if thenSchema, ok := s["then"].(jsonSchema); ok {
+				errors = append(errors, validateSchema(thenSchema, value, valuePath)...)
+			}
+		} else if elseSchema, ok := s["else"].(jsonSchema); ok {
+			errors = append(errors, validateSchema(elseSchema, value, valuePath)...)
+		}
+	}
+
+	return errors
+}
+
+func hasSchemaErrors(errors []schemaError) bool {
+	for _, e := range errors {
+		if !e.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaTypeMatches(schemaType interface{}, value interface{}) bool {
+	switch t := schemaType.(type) {
+	case string:
+		valueType := jsonTypeName(value)
+		return valueType == t || (t == "number" && valueType == "integer")
+	case []interface{}:
+		for _, sub := range t {
+			if schemaTypeMatches(sub, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaTypeString(schemaType interface{}) string {
+	if types, ok := schemaType.([]interface{}); ok {
+		var names []string
+		for _, t := range types {
+			names = append(names, fmt.Sprintf("%v", t))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprintf("%v", schemaType)
+}
+
+// jsonTypeName returns the JSON Schema type name for a decoded JSON value
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaPathString formats a path of keys and indexes, i.e. roles[0].name
+func schemaPathString(valuePath []interface{}) string {
+	var b strings.Builder
+	for _, p := range valuePath {
+		switch k := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", k)
+		default:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprintf(&b, "%v", k)
+		}
+	}
+	return b.String()
+}
+
+func copyPath(valuePath []interface{}) []interface{} {
+	return append([]interface{}{}, valuePath...)
+}
+
+func stringsToInterfaces(list []string) []interface{} {
+	var result []interface{}
+	for _, item := range list {
+		result = append(result, item)
+	}
+	return result
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type schemaTestEmbedded struct {
+	Embedded string `json:"embedded"`
+}
+
+type schemaTestItem struct {
+	Name     string           `json:"name"`
+	Enabled  *bool            `json:"enabled,omitempty"`
+	Tags     []string         `json:"tags"`
+	Limits   map[string]int   `json:"limits"`
+	Ratio    float64          `json:"ratio"`
+	TTL      duration         `json:"ttl"`
+	Any      interface{}      `json:"any"`
+	Children []schemaTestItem `json:"-"`
+	internal string
+
+	schemaTestEmbedded
+}
+
+func TestSchemaFromType(t *testing.T) {
+	want := jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"name":     jsonSchema{"type": "string"},
+			"enabled":  jsonSchema{"type": "boolean"},
+			"tags":     jsonSchema{"type": "array", "items": jsonSchema{"type": "string"}},
+			"limits":   jsonSchema{"type": "object", "additionalProperties": jsonSchema{"type": "integer"}},
+			"ratio":    jsonSchema{"type": "number"},
+			"ttl":      durationSchema,
+			"any":      jsonSchema{},
+			"embedded": jsonSchema{"type": "string"},
+		},
+		"additionalProperties": false,
+	}
+
+	got := schemaFromType(reflect.TypeOf(schemaTestItem{}))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schemaFromType() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	role := jsonSchema{
+		"type": "object",
+		"properties": jsonSchema{
+			"name":  jsonSchema{"type": "string", "minLength": 1},
+			"type":  jsonSchema{"enum": []interface{}{"iam", "ec2"}},
+			"ttl":   durationSchema,
+			"count": jsonSchema{"type": "integer"},
+			"ratio": jsonSchema{"type": "number"},
+		},
+		"required":             []interface{}{"name"},
+		"additionalProperties": false,
+	}
+	roles := jsonSchema{
+		"type":       "object",
+		"properties": jsonSchema{"roles": jsonSchema{"type": "array", "items": role}},
+	}
+	extendable := jsonSchema{
+		"type":       "object",
+		"properties": jsonSchema{"name": jsonSchema{"type": "string"}},
+		"required":   []interface{}{"name"},
+	}
+	extendable.allowExtends()
+
+	tests := []struct {
+		name   string
+		schema jsonSchema
+		value  string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			schema: role,
+			value:  `{"name": "a", "type": "iam", "ttl": "1h", "count": 2, "ratio": 2}`,
+		},
+		{
+			name:   "wrong type",
+			schema: role,
+			value:  `{"name": "a", "count": 1.5}`,
+			want:   []string{"count: Invalid value for 'count': expected integer but got number"},
+		},
+		{
+			name:   "multiple types",
+			schema: role,
+			value:  `{"name": "a", "ttl": true}`,
+			want:   []string{"ttl: Invalid value for 'ttl': expected string or integer but got boolean"},
+		},
+		{
+			name:   "enum",
+			schema: role,
+			value:  `{"name": "a", "type": "gcp"}`,
+			want:   []string{"type: Invalid value [gcp] for 'type', must be one of: [iam ec2]"},
+		},
+		{
+			name:   "pattern",
+			schema: role,
+			value:  `{"name": "a", "ttl": "1 hour"}`,
+			want:   []string{"ttl: Invalid value [1 hour] for 'ttl', expected a number of seconds or a duration string (i.e. 1h, 30m or 7d)"},
+		},
+		{
+			name:   "negative duration",
+			schema: role,
+			value:  `{"name": "a", "ttl": "-1"}`,
+			want:   []string{"ttl: Invalid value [-1] for 'ttl', expected a number of seconds or a duration string (i.e. 1h, 30m or 7d)"},
+		},
+		{
+			name:   "minimum",
+			schema: role,
+			value:  `{"name": "a", "ttl": -5}`,
+			want:   []string{"ttl: Invalid value [-5] for 'ttl', must be at least 0"},
+		},
+		{
+			name:   "signed duration",
+			schema: jsonSchema{"properties": jsonSchema{"leeway": signedDurationSchema}},
+			value:  `{"leeway": "-1"}`,
+		},
+		{
+			name:   "empty string",
+			schema: role,
+			value:  `{"name": ""}`,
+			want:   []string{"name: 'name' must not be empty"},
+		},
+		{
+			name:   "missing required field",
+			schema: role,
+			value:  `{}`,
+			want:   []string{": Missing required field 'name'"},
+		},
+		{
+			name:   "unknown field",
+			schema: role,
+			value:  `{"name": "a", "nmae": "b"}`,
+			want:   []string{"warning nmae: Unknown field 'nmae' will be ignored"},
+		},
+		{
+			name:   "nested path",
+			schema: roles,
+			value:  `{"roles": [{"name": "a"}, {"name": 1}]}`,
+			want:   []string{"roles[1].name: Invalid value for 'roles[1].name': expected string but got integer"},
+		},
+		{
+			name:   "typed placeholder",
+			schema: role,
+			value:  `{"name": "a", "count": "%[COUNT]%"}`,
+		},
+		{
+			name:   "required without extends",
+			schema: extendable,
+			value:  `{}`,
+			want:   []string{": Missing required field 'name'"},
+		},
+		{
+			name:   "required with extends",
+			schema: extendable,
+			value:  `{"extends": "base"}`,
+			want:   []string{": Missing required field 'name'"},
+		},
+		{
+			name:   "extends",
+			schema: extendable,
+			value:  `{"name": "a", "extends": ["base", "tagged"]}`,
+		},
+		{
+			name:   "allOf",
+			schema: jsonSchema{"allOf": []interface{}{jsonSchema{"type": "object"}, jsonSchema{"required": []interface{}{"a", "b"}}}},
+			value:  `{"a": 1}`,
+			want:   []string{": Missing required field 'b'"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(test.value), &value); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range validateSchema(test.schema, value, nil) {
+				message := schemaPathString(e.Path) + ": " + e.Message
+				if e.Warning {
+					message = "warning " + message
+				}
+				got = append(got, message)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("validateSchema() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigSchemasAreValid(t *testing.T) {
+	// Every configuration schema is written out by the schema command
+	for _, s := range configSchemas {
+		if _, err := json.Marshal(s.Schema); err != nil {
+			t.Errorf("Schema [%s] can't be marshalled: %v", s.Name, err)
+		}
+	}
+}
@@ -4,10 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"path"
 	"strconv"
-	"time"
 )
 
 type SecretsEngineAWS struct {
@@ -32,13 +30,13 @@ type AwsConfigLease struct {
 }
 
 type awsRoleEntry struct {
-	CredentialType string        `json:"credential_type",yaml:"credential_type"`                     // Entries must all be in the set of ("iam_user", "assumed_role", "federation_token")
-	PolicyArns     []string      `json:"policy_arns",yaml:"policy_arns"`                             // ARNs of managed policies to attach to an IAM user
-	RoleArns       []string      `json:"role_arns,yaml:"role_arns"`                                  // ARNs of roles to assume for AssumedRole credentials
-	PolicyDocument string        `json:"policy_document",yaml:"policy_document"`                     // JSON-serialized inline policy to attach to IAM users and/or to specify as the Policy parameter in AssumeRole calls
-	RawPolicy      interface{}   `json:"raw_policy,omitempty",yaml:"raw_policy,omitempty"`           // Custom field to allow policy to be entered as json as opposed to having to escape it
-	DefaultSTSTTL  time.Duration `json:"default_sts_ttl,omitempty",yaml:"default_sts_ttl,omitempty"` // Default TTL for STS credentials
-	MaxSTSTTL      time.Duration `json:"max_sts_ttl,omitempty",yaml:"max_sts_ttl,omitempty"`         // Max allowed TTL for STS credentials
+	CredentialType string      `json:"credential_type" yaml:"credential_type"`                     // Entries must all be in the set of ("iam_user", "assumed_role", "federation_token")
+	PolicyArns     []string    `json:"policy_arns" yaml:"policy_arns"`                             // ARNs of managed policies to attach to an IAM user
+	RoleArns       []string    `json:"role_arns" yaml:"role_arns"`                                 // ARNs of roles to assume for AssumedRole credentials
+	PolicyDocument string      `json:"policy_document" yaml:"policy_document"`                     // JSON-serialized inline policy to attach to IAM users and/or to specify as the Policy parameter in AssumeRole calls
+	RawPolicy      interface{} `json:"raw_policy,omitempty" yaml:"raw_policy,omitempty"`           // Custom field to allow policy to be entered as json as opposed to having to escape it
+	DefaultSTSTTL  duration    `json:"default_sts_ttl,omitempty" yaml:"default_sts_ttl,omitempty"` // Default TTL for STS credentials
+	MaxSTSTTL      duration    `json:"max_sts_ttl,omitempty" yaml:"max_sts_ttl,omitempty"`         // Max allowed TTL for STS credentials
 }
 
 func ConfigureAwsSecretsEngine(secretsEngine SecretsEngine) {
@@ -46,9 +44,14 @@ func ConfigureAwsSecretsEngine(secretsEngine SecretsEngine) {
 	var secretsEngineAWS SecretsEngineAWS
 
 	// Read in AWS root configuration
-	content, err := ioutil.ReadFile(Spec.ConfigurationPath + "/secrets-engines/" + secretsEngine.Path + "aws.json")
+	configFile, ok := findConfigFile(path.Join(Spec.ConfigurationPath, "secrets-engines", secretsEngine.ConfigDir), "aws")
+	if !ok {
+		log.Fatal("AWS secrets engine config file for path [" + secretsEngine.Path + "] not found. Cannot configure engine.")
+	}
+
+	content, err := readConfigFile(configFile)
 	if err != nil {
-		log.Fatal("AWS secrets engine config file for path ["+secretsEngine.Path+"] not found. Cannot configure engine.", err)
+		log.Fatal(err)
 	}
 
 	// Perform any substitutions
@@ -56,13 +59,11 @@ func ConfigureAwsSecretsEngine(secretsEngine SecretsEngine) {
 	success, errMsg := performSubstitutions(&contentstring, "secrets-engines/"+secretsEngine.Name)
 	if !success {
 		log.Warn(errMsg)
-		log.Warn("Secret substitution failed for [" + Spec.ConfigurationPath + "secrets-engines/" + secretsEngine.Path + "aws.json" + "], skipping secret engine [" + secretsEngine.Path + "]")
+		log.Warn("Secret substitution failed for [" + configFile + "], skipping secret engine [" + secretsEngine.Path + "]")
 		return
 	}
 
-	if !isJSON(contentstring) {
-		log.Fatal("AWS secrets engine aws.json for [" + secretsEngine.Path + "] is not a valid JSON file.")
-	}
+	checkSubstitutedTypes(contentstring, "secrets-engine-aws", "AWS secrets engine config for ["+secretsEngine.Path+"]")
 
 	err = json.Unmarshal([]byte(contentstring), &secretsEngineAWS)
 	if err != nil {
@@ -124,11 +125,16 @@ func getAwsRoles(secretsEngine *SecretsEngine, secretsEngineAWS *SecretsEngineAW
 
 	secretsEngineAWS.Roles = make(map[string]awsRoleEntry)
 
-	roleConfigDirPath := path.Join(Spec.ConfigurationPath, "secrets-engines", secretsEngine.Path, "roles")
+	roleConfigDirPath := path.Join(Spec.ConfigurationPath, "secrets-engines", secretsEngine.ConfigDir, "roles")
 	rawRoles := processDirectoryRaw(roleConfigDirPath)
 	for roleName, rawRole := range rawRoles {
+		rawRole, err := applyExtends(templateKindAwsRoles, rawRole)
+		if err != nil {
+			log.Fatalf("Error applying templates to AWS role [%s]: %v", path.Join(roleConfigDirPath, roleName), err)
+		}
+
 		var role awsRoleEntry
-		err := json.Unmarshal(rawRole, &role)
+		err = json.Unmarshal(rawRole, &role)
 		if err != nil {
 			log.Fatalf("Error parsing AWS role [%s]: %v", path.Join(roleConfigDirPath, roleName), err)
 		}
@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"path"
-	"path/filepath"
 )
 
 type SecretsEngineDatabase struct {
@@ -18,9 +16,14 @@ func ConfigureDatabaseSecretsEngine(secretsEngine SecretsEngine) {
 	var secretsEngineDatabase SecretsEngineDatabase
 
 	// Read in database configuration
-	content, err := ioutil.ReadFile(Spec.ConfigurationPath + "/secrets-engines/" + secretsEngine.Path + "db.json")
+	configFile, ok := findConfigFile(path.Join(Spec.ConfigurationPath, "secrets-engines", secretsEngine.ConfigDir), "db")
+	if !ok {
+		log.Fatal("Database secrets engine config file for path [" + secretsEngine.Path + "] not found. Cannot configure engine.")
+	}
+
+	content, err := readConfigFile(configFile)
 	if err != nil {
-		log.Fatal("Database secrets engine config file for path ["+secretsEngine.Path+"] not found. Cannot configure engine.", err)
+		log.Fatal(err)
 	}
 
 	// Perform any substitutions
@@ -28,13 +31,11 @@ func ConfigureDatabaseSecretsEngine(secretsEngine SecretsEngine) {
 	success, errMsg := performSubstitutions(&contentstring, "secrets-engines/"+secretsEngine.Name)
 	if !success {
 		log.Warn(errMsg)
-		log.Warn("Secret substitution failed for [" + Spec.ConfigurationPath + "secrets-engines/" + secretsEngine.Path + "aws.json" + "], skipping secret engine [" + secretsEngine.Path + "]")
+		log.Warn("Secret substitution failed for [" + configFile + "], skipping secret engine [" + secretsEngine.Path + "]")
 		return
 	}
 
-	if !isJSON(contentstring) {
-		log.Fatal("Database secrets engine db.json for [" + secretsEngine.Path + "] is not a valid JSON file.")
-	}
+	checkSubstitutedTypes(contentstring, "secrets-engine-database", "Database secrets engine config for ["+secretsEngine.Path+"]")
 
 	// Get roles associated with this engine
 	getDatabaseRoles(&secretsEngine, &secretsEngineDatabase)
@@ -83,21 +84,21 @@ func getDatabaseRoles(secretsEngine *SecretsEngine, secretsEngineDatabase *Secre
 
 	secretsEngineDatabase.Roles = make(map[string]string)
 
-	files, err := ioutil.ReadDir(Spec.ConfigurationPath + "/secrets-engines/" + secretsEngine.Path + "roles")
+	entries, skipped, err := walkConfigDirectory(path.Join(Spec.ConfigurationPath, "secrets-engines", secretsEngine.ConfigDir, "roles"), isConfigFile, false)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, filePath := range skipped {
+		log.Warn("Database Role file has wrong extension.  Will not be processed: ", filePath)
+	}
 
-	for _, file := range files {
-
-		success, content := getJsonFile(Spec.ConfigurationPath + "/secrets-engines/" + secretsEngine.Path + "roles/" + file.Name())
-		if success {
-			filename := file.Name()
-			role_name := filename[0 : len(filename)-len(filepath.Ext(filename))]
-			secretsEngineDatabase.Roles[role_name] = content
-		} else {
-			log.Warn("Database Role file has wrong extension.  Will not be processed: ", file.Name())
+	for _, entry := range entries {
+		_, content := getConfigFile(entry.Path)
+		resolved, err := applyExtends(templateKindDatabaseRoles, []byte(content))
+		if err != nil {
+			log.Fatalf("Error applying templates to database role [%s]: %v", path.Join(secretsEngine.Path, "roles", entry.Name), err)
 		}
+		secretsEngineDatabase.Roles[entry.Name] = string(resolved)
 	}
 }
 
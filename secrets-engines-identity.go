@@ -6,9 +6,7 @@ import (
 	"github.com/PremiereGlobal/vault-admin/pkg/auth"
 	"github.com/PremiereGlobal/vault-admin/pkg/secrets-engines/identity"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync"
 )
@@ -106,19 +104,21 @@ func (ident *IdentitySecretsEngine) processEntities() {
 	ident.entities = make(identity.EntityList)
 	ident.entityAliases = make(map[string]map[string]identity.Alias)
 
-	files, err := ioutil.ReadDir(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "entities"))
+	entries, skipped, err := walkConfigDirectory(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "entities"), isConfigFile, false)
 	if err != nil {
 		log.Fatalf("Error reading identity entity configurations: %v", err)
 	}
+	for _, filePath := range skipped {
+		log.Warn("File has wrong extension.  Will not be processed: ", filePath)
+	}
 
-	for _, file := range files {
+	for _, entry := range entries {
 
-		success, content := getJsonFile(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "entities", file.Name()))
+		success, content := getConfigFile(entry.Path)
 		if success {
 			var config EntityConfig
 
-			filename := file.Name()
-			entityName := filename[0 : len(filename)-len(filepath.Ext(filename))]
+			entityName := entry.Name
 			err = json.Unmarshal([]byte(content), &config)
 			if err != nil {
 				log.Fatalf("Error parsing entity file '%s': %v", path.Join(ident.MountPath, "entities/", entityName), err)
@@ -207,22 +207,28 @@ func (ident *IdentitySecretsEngine) processGroups() {
 	ident.groups = make(identity.GroupList)
 	ident.groupAliases = make(map[string]map[string]identity.Alias)
 
-	files, err := ioutil.ReadDir(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "groups"))
+	entries, skipped, err := walkConfigDirectory(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "groups"), isConfigFile, false)
 	if err != nil {
 		log.Fatalf("Error reading identity group configurations: %v", err)
 	}
+	for _, filePath := range skipped {
+		log.Warn("File has wrong extension.  Will not be processed: ", filePath)
+	}
 
 	// For each group, build the data
-	for _, file := range files {
+	for _, entry := range entries {
 
-		success, content := getJsonFile(path.Join(Spec.ConfigurationPath, "secrets-engines", ident.MountPath, "groups", file.Name()))
+		success, content := getConfigFile(entry.Path)
 		if success {
 
 			var config GroupConfig
 
-			filename := file.Name()
-			groupName := filename[0 : len(filename)-len(filepath.Ext(filename))]
-			err = json.Unmarshal([]byte(content), &config)
+			groupName := entry.Name
+			resolved, err := applyExtends(templateKindIdentityGroups, []byte(content))
+			if err != nil {
+				log.Fatalf("Error applying templates to identity group [%s]: %v", path.Join(ident.MountPath, "groups", groupName), err)
+			}
+			err = json.Unmarshal(resolved, &config)
 			if err != nil {
 				log.Fatalf("Error parsing identity group [%s]: %v", path.Join(ident.MountPath, "groups", groupName), err)
 			}
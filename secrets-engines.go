@@ -6,12 +6,14 @@ import (
 	VaultApi "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
+	"os"
 	"path"
 )
 
 type SecretsEngine struct {
 	Name         string
 	Path         string
+	ConfigDir    string // Directory of the engine's configuration, relative to secrets-engines/
 	MountInput   VaultApi.MountInput
 	EngineConfig interface{}
 	JustEnabled  bool // Flagged the first time a mount gets enabled
@@ -30,38 +32,94 @@ func SyncSecretsEngines() {
 }
 
 func GetSecretsEngines(secretsEnginesList SecretsEnginesList) {
-	files, err := ioutil.ReadDir(Spec.ConfigurationPath + "/secrets-engines/")
-	if err != nil {
+	engineDirs, err := findSecretsEngineDirs(path.Join(Spec.ConfigurationPath, "secrets-engines"))
+	if os.IsNotExist(err) {
 		log.Warn("No secrets engines found: ", err)
+	} else if err != nil {
+		log.Fatal(err)
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			var se SecretsEngine
-			se.Name = file.Name()
-			se.Path = file.Name() + "/"
+	for _, engineDir := range engineDirs {
+		var se SecretsEngine
+		se.Name = engineDir.Name
+		se.Path = engineDir.Name + "/"
+		se.ConfigDir = engineDir.Path
 
-			// Identity store doesn't have any configure as it is enabled by default
-			if se.Name != "identity" {
+		// Identity store doesn't have any configure as it is enabled by default
+		if se.Name != "identity" {
 
-				content, err := ioutil.ReadFile(Spec.ConfigurationPath + "/secrets-engines/" + file.Name() + "/config.json")
-				if err != nil {
-					log.Fatal("Config file for secret engine ["+se.Path+"] not found. ", err)
-				}
+			configFile, ok := findConfigFile(path.Join(Spec.ConfigurationPath, "secrets-engines", se.ConfigDir), "config")
+			if !ok {
+				log.Fatal("Config file for secret engine [" + se.Path + "] not found.")
+			}
 
-				if !isJSON(string(content)) {
-					log.Fatal("Secret engine config.json for [" + se.Path + "] is not a valid JSON file.")
-				}
+			content, err := readConfigFile(configFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			err = json.Unmarshal(content, &se.MountInput)
+			if err != nil {
+				log.Fatal("Error parsing secret backend config for [" + se.Path + "]")
+			}
+		}
+
+		if _, ok := secretsEnginesList[se.Path]; ok {
+			log.Fatalf("Secrets engine [%s] is configured more than once", se.Path)
+		}
+		secretsEnginesList[se.Path] = se
+	}
+}
+
+// findSecretsEngineDirs finds the secrets engine directories. A directory
+// with a config file (or the top level identity directory) is an engine, and
+// directories containing nothing but other directories are walked into so
+// engines can be nested. Any other directory is an engine missing its config
+// file, which is an error so the engine isn't cleaned up. The returned Path
+// of each is relative to the secrets-engines directory
+func findSecretsEngineDirs(enginesPath string) ([]configEntry, error) {
+
+	var engineDirs []configEntry
+
+	var walk func(relPath string, prefix []string) error
+	walk = func(relPath string, prefix []string) error {
+		files, err := ioutil.ReadDir(path.Join(enginesPath, relPath))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if !file.IsDir() {
+				continue
+			}
+
+			dirPath := path.Join(relPath, file.Name())
+			configFile, isEngine := findConfigFile(path.Join(enginesPath, dirPath), "config")
+			if isEngine || dirPath == "identity" {
+				engineDirs = append(engineDirs, configEntry{Name: configItemName(prefix, file.Name()), Path: dirPath})
+				continue
+			}
 
-				err = json.Unmarshal([]byte(content), &se.MountInput)
-				if err != nil {
-					log.Fatal("Error parsing secret backend config for [" + se.Path + "]")
+			contents, err := ioutil.ReadDir(path.Join(enginesPath, dirPath))
+			if err != nil {
+				return err
+			}
+			for _, content := range contents {
+				if !content.IsDir() || content.Name() == "roles" {
+					return fmt.Errorf("Config file for secrets engine [%s] not found, expected [%s]", dirPath, configFile)
 				}
 			}
 
-			secretsEnginesList[se.Path] = se
+			if err := walk(dirPath, append(prefix, file.Name())); err != nil {
+				return err
+			}
 		}
+
+		return nil
 	}
+
+	err := walk("", nil)
+	return engineDirs, err
 }
 
 func ConfigureSecretsEngines(secretsEnginesList SecretsEnginesList) {
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindSecretsEngineDirs(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    []configEntry
+		wantErr string
+	}{
+		{
+			name:  "nested",
+			files: []string{"identity/entities/a.json", "kv/config.json", "team/aws/config.yaml", "team/aws/roles/a.json"},
+			want: []configEntry{
+				{Name: "identity", Path: "identity"},
+				{Name: "kv", Path: "kv"},
+				{Name: "team/aws", Path: "team/aws"},
+			},
+		},
+		{
+			name:    "misnamed config file",
+			files:   []string{"kv/conifg.json"},
+			wantErr: "Config file for secrets engine [kv] not found",
+		},
+		{
+			name:    "roles without a config file",
+			files:   []string{"team/aws/config.yml.bak", "team/db/roles/a.json"},
+			wantErr: "Config file for secrets engine [team/aws] not found",
+		},
+		{
+			name:    "nested roles without a config file",
+			files:   []string{"team/db/roles/a.json"},
+			wantErr: "Config file for secrets engine [team/db] not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for _, file := range test.files {
+				files["secrets-engines/"+file] = "{}"
+			}
+			dir := writeConfigDir(t, files)
+			setSpec(t, &Spec.NameSeparator, "/")
+
+			got, err := findSecretsEngineDirs(dir + "/secrets-engines")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("findSecretsEngineDirs() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findSecretsEngineDirs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Placeholders are in the form %{KEY}% which uses the default source for the
+// run (--substitution-source) or %{source:KEY}% to choose the source per value
+var substitutionRegex = regexp.MustCompile(`%\{(?:([a-z]+):)?([a-zA-Z0-9_./~-]+)\}%`)
+
+// Typed placeholders, "%[KEY]%" or "%[source:KEY]%", replace a whole JSON
+// string (including the quotes) with a JSON value, allowing numbers, booleans,
+// lists and objects to be substituted
+var typedSubstitutionRegex = regexp.MustCompile(`"%\[(?:([a-z]+):)?([a-zA-Z0-9_./~-]+)\]%"`)
+
+// Both kinds of placeholder, replaced in a single pass over the content so
+// substituted values are never searched for placeholders themselves
+var anySubstitutionRegex = regexp.MustCompile(typedSubstitutionRegex.String() + `|` + substitutionRegex.String())
+
+// isTypedPlaceholder returns whether a string value is a typed placeholder
+func isTypedPlaceholder(value string) bool {
+	quoted := `"` + value + `"`
+	return typedSubstitutionRegex.FindString(quoted) == quoted
+}
+
+// substitutionProvider is a source of substitution values. secretPath is the
+// path of the item being configured (i.e. secrets-engines/aws-main) which
+// providers that group values by item use to find the value
+type substitutionProvider interface {
+	lookup(secretPath string, key string) (interface{}, bool, error)
+}
+
+// Available substitution sources
+var substitutionProviders = map[string]substitutionProvider{
+	"vault":  &vaultProvider{},
+	"env":    &envProvider{},
+	"file":   &fileProvider{},
+	"dotenv": &dotenvProvider{},
+	"sops":   &encryptedFileProvider{name: "sops", file: func() string { return Spec.SopsFile }, decrypt: sopsDecrypt},
+	"age":    &encryptedFileProvider{name: "age", file: func() string { return Spec.AgeFile }, decrypt: ageDecrypt},
+}
+
+// performSubstitutions replaces all the placeholders in content, which must
+// be JSON, with their values. If any can't be found, false is returned along
+// with a message listing them
+func performSubstitutions(content *string, secretPath string) (bool, string) {
+
+	var missing []string
+	var substitutionErr error
+
+	*content = anySubstitutionRegex.ReplaceAllStringFunc(*content, func(placeholder string) string {
+		match := anySubstitutionRegex.FindStringSubmatch(placeholder)
+		source, key, toJSON := match[3], match[4], substitutionJSONString
+		if strings.HasPrefix(placeholder, `"`) {
+			source, key, toJSON = match[1], match[2], substitutionJSONValue
+		}
+
+		value, found, err := lookupSubstitution(secretPath, source, key)
+		if err == nil && found {
+			registerSecretValue(value)
+			var jsonValue string
+			if jsonValue, err = toJSON(value); err == nil {
+				return jsonValue
+			}
+		}
+
+		if err != nil {
+			substitutionErr = fmt.Errorf("%s: %v", placeholder, err)
+		} else {
+			missing = append(missing, placeholder)
+		}
+		return placeholder
+	})
+
+	if substitutionErr != nil {
+		return false, fmt.Sprintf("Secret substitution failed for [%s]: %v", secretPath, substitutionErr)
+	}
+
+	if len(missing) > 0 {
+		return false, fmt.Sprintf("The following substitutions were detected but not found for ["+secretPath+"] (default source: %s): %v", Spec.SubstitutionSource, strings.Join(missing, ", "))
+	}
+
+	return true, ""
+}
+
+// lookupSubstitution finds the value of a placeholder from its source, or the
+// default source if none is given
+func lookupSubstitution(secretPath string, source string, key string) (interface{}, bool, error) {
+	if source == "" {
+		source = Spec.SubstitutionSource
+	}
+
+	provider, ok := substitutionProviders[source]
+	if !ok {
+		return nil, false, fmt.Errorf("Unknown substitution source [%s]", source)
+	}
+
+	return provider.lookup(secretPath, key)
+}
+
+// substitutionJSONString converts a value to a string escaped for use within
+// a JSON string. Only single values (strings, numbers, booleans) can be used
+func substitutionJSONString(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, int, float64, bool, json.Number:
+	default:
+		return "", fmt.Errorf("Value must be a string, number or boolean but got %T, use a typed placeholder (\"%%[KEY]%%\") for lists and objects", value)
+	}
+
+	jsonValue, err := json.Marshal(fmt.Sprint(value))
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonValue[1 : len(jsonValue)-1]), nil
+}
+
+// substitutionJSONValue converts a value to JSON for a typed placeholder.
+// Sources such as environment variables only have strings so strings that are
+// valid JSON are used as-is, otherwise they are substituted as a JSON string
+func substitutionJSONValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		var v interface{}
+		if json.Unmarshal([]byte(s), &v) == nil {
+			return s, nil
+		}
+	}
+
+	jsonValue, err := json.Marshal(value)
+	return string(jsonValue), err
+}
+
+// checkSubstitutedTypes validates content against a configuration schema once
+// the substitutions have been made, so values of the wrong type from typed
+// placeholders are caught before they are written to Vault
+func checkSubstitutedTypes(content string, schemaName string, description string) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		log.Fatalf("%s is not valid JSON after secret substitution: %v", description, err)
+	}
+
+	failed := false
+	for _, e := range validateSchema(getConfigSchema(schemaName), value, nil) {
+		if !e.Warning {
+			log.Errorf("%s: %s", description, e.Message)
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatalf("%s is invalid after secret substitution", description)
+	}
+}
+
+// vaultProvider reads values from the KV store at VaultSecretBasePath
+type vaultProvider struct {
+	mutex sync.Mutex
+	cache map[string]map[string]interface{}
+}
+
+func (p *vaultProvider) lookup(secretPath string, key string) (interface{}, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cache == nil {
+		p.cache = make(map[string]map[string]interface{})
+	}
+
+	secrets, ok := p.cache[secretPath]
+	if !ok {
+		_, secrets = getSecretArray(Spec.VaultSecretBasePath + secretPath)
+		p.cache[secretPath] = secrets
+	}
+
+	value, ok := secrets[key]
+	return value, ok, nil
+}
+
+// envProvider reads values from environment variables
+type envProvider struct{}
+
+func (p *envProvider) lookup(secretPath string, key string) (interface{}, bool, error) {
+	value, ok := os.LookupEnv(key)
+	return value, ok, nil
+}
+
+// fileProvider reads values from local files, the key being the path to the
+// file (relative to the configuration path). A trailing newline is removed
+type fileProvider struct{}
+
+func (p *fileProvider) lookup(secretPath string, key string) (interface{}, bool, error) {
+	filePath := key
+	if strings.HasPrefix(filePath, "~/") {
+		filePath = path.Join(os.Getenv("HOME"), filePath[2:])
+	} else if !filepath.IsAbs(filePath) {
+		filePath = path.Join(Spec.ConfigurationPath, filePath)
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("Error reading substitution file [%s]: %v", filePath, err)
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r"), true, nil
+}
+
+// dotenvProvider reads values from a dotenv (KEY=value) file
+type dotenvProvider struct {
+	once   sync.Once
+	values map[string]string
+	err    error
+}
+
+func (p *dotenvProvider) lookup(secretPath string, key string) (interface{}, bool, error) {
+	p.once.Do(func() {
+		if Spec.DotenvFile == "" {
+			p.err = fmt.Errorf("The dotenv substitution source requires the --dotenv-file option")
+			return
+		}
+		p.values, p.err = readDotenvFile(Spec.DotenvFile)
+	})
+	if p.err != nil {
+		return "", false, p.err
+	}
+
+	value, ok := p.values[key]
+	return value, ok, nil
+}
+
+// readDotenvFile parses a dotenv file. Blank lines, comments and the export
+// keyword are ignored and values can be single or double quoted
+func readDotenvFile(filePath string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading dotenv file [%s]: %v", filePath, err)
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid line in dotenv file [%s:%d]", filePath, lineNumber)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			quote := value[0]
+			value = value[1 : len(value)-1]
+			if quote == '"' {
+				value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+			}
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// encryptedFileProvider reads values from an encrypted YAML (or JSON) file
+// which is decrypted locally. The file is laid out the same as the secrets in
+// Vault, each secret path being a map of keys:
+//
+//	secrets-engines/aws-main:
+//	  AWS_ACCESS_KEY_ID: xxxx
+//
+// Top level keys are also available to every secret path
+type encryptedFileProvider struct {
+	name    string
+	file    func() string
+	decrypt func(filePath string) ([]byte, error)
+
+	once   sync.Once
+	values map[string]interface{}
+	err    error
+}
+
+func (p *encryptedFileProvider) lookup(secretPath string, key string) (interface{}, bool, error) {
+	p.once.Do(func() {
+		filePath := p.file()
+		if filePath == "" {
+			p.err = fmt.Errorf("The %s substitution source requires the --%s-file option", p.name, p.name)
+			return
+		}
+
+		content, err := p.decrypt(filePath)
+		if err != nil {
+			p.err = fmt.Errorf("Error decrypting %s file [%s]: %v", p.name, filePath, err)
+			return
+		}
+
+		if err := yaml.Unmarshal(content, &p.values); err != nil {
+			p.err = fmt.Errorf("Decrypted %s file [%s] is not valid YAML: %v", p.name, filePath, err)
+		}
+	})
+	if p.err != nil {
+		return "", false, p.err
+	}
+
+	if secrets, ok := p.values[secretPath].(map[string]interface{}); ok {
+		if value, ok := secrets[key]; ok {
+			return value, true, nil
+		}
+	}
+
+	if value, ok := p.values[key]; ok {
+		return value, true, nil
+	}
+
+	return "", false, nil
+}
+
+// sopsDecrypt decrypts a file using the sops CLI
+func sopsDecrypt(filePath string) ([]byte, error) {
+	return runDecrypt("sops", "--decrypt", filePath)
+}
+
+// ageDecrypt decrypts a file using the age CLI with the identity file from
+// --age-identity
+func ageDecrypt(filePath string) ([]byte, error) {
+	if Spec.AgeIdentity == "" {
+		return nil, fmt.Errorf("The age substitution source requires the --age-identity option")
+	}
+	return runDecrypt("age", "--decrypt", "--identity", Spec.AgeIdentity, filePath)
+}
+
+// runDecrypt runs a decryption command and returns its output
+func runDecrypt(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubstitutionRegex(t *testing.T) {
+	tests := []struct {
+		content string
+		want    [][]string
+	}{
+		{content: `"%{KEY}%"`, want: [][]string{{"%{KEY}%", "", "KEY"}}},
+		{content: `"%{env:AWS_KEY}% and %{file:certs/ca.pem}%"`, want: [][]string{{"%{env:AWS_KEY}%", "env", "AWS_KEY"}, {"%{file:certs/ca.pem}%", "file", "certs/ca.pem"}}},
+		{content: `"%{file:~/token}%"`, want: [][]string{{"%{file:~/token}%", "file", "~/token"}}},
+		// Vault's own templates and the template stage aren't placeholders
+		{content: `"{{name}} %{{ .Vars.x }}% %{}% %{ KEY }%"`},
+	}
+
+	for _, test := range tests {
+		if got := substitutionRegex.FindAllStringSubmatch(test.content, -1); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("substitutionRegex(%s) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
+
+func TestReadDotenvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "values",
+			content: "# Comment\n\nA=1\nexport B = two \nC=\nD=a=b\n",
+			want:    map[string]string{"A": "1", "B": "two", "C": "", "D": "a=b"},
+		},
+		{
+			name:    "quoted values",
+			content: "A=\"line1\\nline2\"\nB='single \\n quoted'\nC=\"say \\\"hi\\\"\"\nD=\"unterminated\n",
+			want:    map[string]string{"A": "line1\nline2", "B": "single \\n quoted", "C": `say "hi"`, "D": `"unterminated`},
+		},
+		{
+			name:    "invalid line",
+			content: "A=1\nB\n",
+			wantErr: ".env:2]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), ".env")
+			if err := ioutil.WriteFile(filePath, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readDotenvFile(filePath)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("readDotenvFile() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readDotenvFile() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPerformSubstitutions(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"secrets/password": "file-password\n",
+		".env":             "TOKEN=dotenv-token\nTTL=3600\nPOLICIES=[\"a\",\"b\"]\nNESTED=%{VAULT_ADMIN_TEST_USER}%\nNESTED_TYPED=[\"%[VAULT_ADMIN_TEST_USER]%\"]\n",
+	})
+	setSpec(t, &Spec.SubstitutionSource, "env")
+	setSpec(t, &Spec.DotenvFile, filepath.Join(dir, ".env"))
+	t.Setenv("VAULT_ADMIN_TEST_USER", `ad"min`)
+
+	previous := substitutionProviders
+	substitutionProviders = map[string]substitutionProvider{
+		"env":    &envProvider{},
+		"file":   &fileProvider{},
+		"dotenv": &dotenvProvider{},
+		"sops": &encryptedFileProvider{
+			name: "sops",
+			file: func() string { return "secrets.enc.yaml" },
+			decrypt: func(filePath string) ([]byte, error) {
+				return []byte("SHARED: shared\nauth/ldap:\n  BINDPASS: ldap-password\n  GROUPS: [a, b]\n"), nil
+			},
+		},
+		"age": &encryptedFileProvider{
+			name: "age",
+			file: func() string { return "secrets.age" },
+			decrypt: func(filePath string) ([]byte, error) {
+				return nil, fmt.Errorf("no identity")
+			},
+		},
+	}
+	defer func() { substitutionProviders = previous }()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "default source",
+			content: `{"user": "%{VAULT_ADMIN_TEST_USER}%"}`,
+			want:    `{"user": "ad\"min"}`,
+		},
+		{
+			name:    "sources",
+			content: `{"a": "%{file:secrets/password}%", "b": "%{dotenv:TOKEN}%", "c": "%{sops:BINDPASS}%", "d": "%{sops:SHARED}%"}`,
+			want:    `{"a": "file-password", "b": "dotenv-token", "c": "ldap-password", "d": "shared"}`,
+		},
+		{
+			name:    "typed",
+			content: `{"ttl": "%[dotenv:TTL]%", "policies": "%[dotenv:POLICIES]%", "user": "%[VAULT_ADMIN_TEST_USER]%", "note": "ttl %{dotenv:TTL}%"}`,
+			want:    `{"ttl": 3600, "policies": ["a","b"], "user": "ad\"min", "note": "ttl 3600"}`,
+		},
+		{
+			name:    "placeholders in values",
+			content: `{"a": "%{dotenv:NESTED}%", "b": "%[dotenv:NESTED]%", "c": "%[dotenv:NESTED_TYPED]%"}`,
+			want:    `{"a": "%{VAULT_ADMIN_TEST_USER}%", "b": "%{VAULT_ADMIN_TEST_USER}%", "c": ["%[VAULT_ADMIN_TEST_USER]%"]}`,
+		},
+		{
+			name:    "list in a string",
+			content: `{"groups": "%{sops:GROUPS}%", "typed": "%[sops:GROUPS]%"}`,
+			wantErr: "Secret substitution failed for [auth/ldap]: %{sops:GROUPS}%: Value must be a string, number or boolean but got []interface {}, use a typed placeholder (\"%[KEY]%\") for lists and objects",
+		},
+		{
+			name:    "missing",
+			content: `{"a": "%{VAULT_ADMIN_TEST_MISSING}%", "b": "%{file:secrets/missing}%"}`,
+			wantErr: "The following substitutions were detected but not found for [auth/ldap] (default source: env): %{VAULT_ADMIN_TEST_MISSING}%, %{file:secrets/missing}%",
+		},
+		{
+			name:    "unknown source",
+			content: `{"a": "%{consul:KEY}%"}`,
+			wantErr: "Secret substitution failed for [auth/ldap]: %{consul:KEY}%: Unknown substitution source [consul]",
+		},
+		{
+			name:    "source error",
+			content: `{"a": "%{age:KEY}%"}`,
+			wantErr: "Secret substitution failed for [auth/ldap]: %{age:KEY}%: Error decrypting age file [secrets.age]: no identity",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := test.content
+			ok, message := performSubstitutions(&content, "auth/ldap")
+			if test.wantErr != "" {
+				if ok || message != test.wantErr {
+					t.Fatalf("performSubstitutions() = %v, %q, want %q", ok, message, test.wantErr)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("performSubstitutions() failed: %s", message)
+			}
+			if content != test.want {
+				t.Errorf("performSubstitutions() = %s, want %s", content, test.want)
+			}
+		})
+	}
+}
+
+func TestIsTypedPlaceholder(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "%[KEY]%", want: true},
+		{value: "%[sops:auth/KEY]%", want: true},
+		{value: "%{KEY}%"},
+		{value: "prefix %[KEY]%"},
+		{value: "%[KEY]% %[OTHER]%"},
+		{value: "%[]%"},
+	}
+
+	for _, test := range tests {
+		if got := isTypedPlaceholder(test.value); got != test.want {
+			t.Errorf("isTypedPlaceholder(%s) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSubstitutionJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		wantString string
+		wantValue  string
+	}{
+		{name: "string", value: `a "quoted"` + "\n", wantString: `a \"quoted\"\n`, wantValue: `"a \"quoted\"\n"`},
+		{name: "JSON string", value: `["a","b"]`, wantString: `[\"a\",\"b\"]`, wantValue: `["a","b"]`},
+		{name: "number", value: 3600, wantString: "3600", wantValue: "3600"},
+		{name: "boolean", value: true, wantString: "true", wantValue: "true"},
+		{name: "list", value: []interface{}{"a", 1}, wantValue: `["a",1]`},
+		{name: "object", value: map[string]interface{}{"a": "b"}, wantValue: `{"a":"b"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := substitutionJSONString(test.value)
+			if (err != nil) != (test.wantString == "") || got != test.wantString {
+				t.Errorf("substitutionJSONString() = %s, %v, want %s", got, err, test.wantString)
+			}
+
+			got, err = substitutionJSONValue(test.value)
+			if err != nil || got != test.wantValue {
+				t.Errorf("substitutionJSONValue() = %s, %v, want %s", got, err, test.wantValue)
+			}
+		})
+	}
+}
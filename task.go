@@ -23,6 +23,7 @@ func (t taskWrite) run(workerNum int) bool {
 	if t.Defer != nil {
 		defer t.Defer()
 	}
+	registerSensitiveFields(t.Data)
 	log.Debugf("Writing %s {worker-%d}", t.Description, workerNum)
 	_, err := Vault.Write(t.Path, t.Data)
 	if err != nil {
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Delimiters for the template stage. These differ from the usual {{ }} since
+// Vault itself uses {{name}} style templates in some configuration (such as
+// database creation statements)
+const (
+	templateLeftDelim  = "%{{"
+	templateRightDelim = "}}%"
+)
+
+// templateData is the data available to configuration file templates
+type templateData struct {
+	Env            map[string]string
+	Vars           map[string]interface{}
+	Environment    string
+	SecretBasePath string
+}
+
+var templateDataOnce sync.Once
+var templateDataCache templateData
+var templateDataErr error
+
+// renderTemplate runs the template stage over the content of a configuration
+// file. Files without any template actions are returned as-is
+func renderTemplate(filePath string, content []byte) ([]byte, error) {
+	if !bytes.Contains(content, []byte(templateLeftDelim)) {
+		return content, nil
+	}
+
+	data, err := getTemplateData()
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing map keys are errors so typos in variable names aren't uploaded
+	// to Vault, optional values are looked up with index (see templateDefault)
+	tmpl, err := template.New(filePath).Delims(templateLeftDelim, templateRightDelim).Option("missingkey=error").Funcs(templateFuncs()).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	if err := tmpl.Execute(&result, data); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+// templateErrorLine returns the line number from a template error
+func templateErrorLine(filePath string, err error) int {
+	re := regexp.MustCompile(regexp.QuoteMeta(filePath) + `:(\d+)`)
+	if match := re.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return line
+	}
+	return 0
+}
+
+// getTemplateData builds the template data once per run
+func getTemplateData() (templateData, error) {
+	templateDataOnce.Do(func() {
+		templateDataCache, templateDataErr = loadTemplateData()
+	})
+	return templateDataCache, templateDataErr
+}
+
+// loadTemplateData gathers the environment variables and the variable files.
+// vars/default is loaded first and then vars/<environment> is merged over it
+func loadTemplateData() (templateData, error) {
+	data := templateData{
+		Env:            make(map[string]string),
+		Vars:           make(map[string]interface{}),
+		Environment:    Spec.Environment,
+		SecretBasePath: Spec.VaultSecretBasePath,
+	}
+
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		data.Env[parts[0]] = parts[1]
+	}
+
+	varsPath := path.Join(Spec.ConfigurationPath, "vars")
+	if filePath, ok := findConfigFile(varsPath, "default"); ok {
+		if err := loadTemplateVars(filePath, data.Vars); err != nil {
+			return data, err
+		}
+	}
+
+	if Spec.Environment != "" {
+		filePath, ok := findConfigFile(varsPath, Spec.Environment)
+		if !ok {
+			return data, fmt.Errorf("No variables file found for environment [%s] in [%s]", Spec.Environment, varsPath)
+		}
+		if err := loadTemplateVars(filePath, data.Vars); err != nil {
+			return data, err
+		}
+	}
+
+	return data, nil
+}
+
+// loadTemplateVars reads in a variables file and merges it into vars
+func loadTemplateVars(filePath string, vars map[string]interface{}) error {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("Error reading variables file [%s]: %v", filePath, err)
+	}
+
+	if !checkExt(filePath, ".json") {
+		content, err = yamlToJSON(content)
+		if err != nil {
+			return fmt.Errorf("Variables file [%s] is not valid YAML: %v", filePath, err)
+		}
+	}
+
+	var fileVars map[string]interface{}
+	if err := json.Unmarshal(content, &fileVars); err != nil {
+		return fmt.Errorf("Variables file [%s] is not valid JSON: %v", filePath, err)
+	}
+
+	for k, v := range fileVars {
+		vars[k] = v
+	}
+
+	return nil
+}
+
+// templateFuncs are the helper functions available to templates
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default":  templateDefault,
+		"required": templateRequired,
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(s)
+			return string(decoded), err
+		},
+		"toJson": func(v interface{}) (string, error) {
+			jsonData, err := json.Marshal(v)
+			return string(jsonData), err
+		},
+		"join":  templateJoin,
+		"split": strings.Split,
+		"list": func(items ...interface{}) []interface{} {
+			return items
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"env":   os.Getenv,
+	}
+}
+
+// templateDefault returns the value if it is set, otherwise the default.
+// Variables that may not exist are looked up with index, since a missing key
+// is an error. Usage: %{{ default "value" (index .Vars "name") }}%
+func templateDefault(defaultValue interface{}, value interface{}) interface{} {
+	if templateIsEmpty(value) {
+		return defaultValue
+	}
+	return value
+}
+
+// templateRequired returns an error if the value isn't set.
+// Usage: %{{ required "name must be set" (index .Vars "name") }}%
+func templateRequired(message string, value interface{}) (interface{}, error) {
+	if templateIsEmpty(value) {
+		return nil, fmt.Errorf("%s", message)
+	}
+	return value, nil
+}
+
+// templateJoin joins a list of any type into a string.
+// Usage: %{{ join "," .Vars.list }}%
+func templateJoin(sep string, value interface{}) (string, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list but got %T", value)
+	}
+
+	items := make([]string, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+
+	return strings.Join(items, sep), nil
+}
+
+// templateIsEmpty returns whether a template value is unset or empty
+func templateIsEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
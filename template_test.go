@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"vars/default.yaml": "region: us-east-1\nteams: [a, b]\nreplicas: 2\nnote: <no value>\n",
+		"vars/prod.json":    `{"region": "us-west-2", "debug": false}`,
+	})
+	setSpec(t, &Spec.Environment, "prod")
+	setSpec(t, &Spec.VaultSecretBasePath, "secret/vault-admin/")
+	t.Setenv("VAULT_ADMIN_TEST_VALUE", "from-env")
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "no template actions",
+			content: `{"statement": "CREATE USER '{{name}}'"}`,
+			want:    `{"statement": "CREATE USER '{{name}}'"}`,
+		},
+		{
+			name:    "environment overrides default",
+			content: `{"region": "%{{ .Vars.region }}%", "environment": "%{{ .Environment }}%"}`,
+			want:    `{"region": "us-west-2", "environment": "prod"}`,
+		},
+		{
+			name:    "environment variables",
+			content: `{"a": "%{{ .Env.VAULT_ADMIN_TEST_VALUE }}%", "b": "%{{ env "VAULT_ADMIN_TEST_VALUE" }}%"}`,
+			want:    `{"a": "from-env", "b": "from-env"}`,
+		},
+		{
+			name:    "functions",
+			content: `%{{ join "," .Vars.teams | upper }}% %{{ toJson .Vars.teams }}% %{{ b64enc "abc" }}% %{{ .SecretBasePath }}%`,
+			want:    `A,B ["a","b"] YWJj secret/vault-admin/`,
+		},
+		{
+			name:    "default",
+			content: `%{{ default "none" (index .Vars "missing") }}% %{{ default 1 .Vars.replicas }}% %{{ default true .Vars.debug }}%`,
+			want:    `none 2 false`,
+		},
+		{
+			name:    "required",
+			content: "{\n  \"owner\": \"%{{ required \"owner must be set\" (index .Vars \"owner\") }}%\"\n}",
+			wantErr: "owner must be set",
+		},
+		{
+			name:    "missing value",
+			content: "{\n  \"owner\": \"%{{ .Vars.owner }}%\"\n}",
+			wantErr: "template: test.json:2:21: executing \"test.json\" at <.Vars.owner>: map has no entry for key \"owner\"",
+		},
+		{
+			name:    "missing value passed to a function",
+			content: `{"owner": "%{{ .Vars.owner | upper }}%"}`,
+			wantErr: "template: test.json:1:20: executing \"test.json\" at <.Vars.owner>: map has no entry for key \"owner\"",
+		},
+		{
+			name:    "value containing <no value>",
+			content: `{"note": "%{{ .Vars.note }}%", "raw": "<no value>"}`,
+			want:    `{"note": "<no value>", "raw": "<no value>"}`,
+		},
+		{
+			name:    "syntax error",
+			content: `%{{ if }}%`,
+			wantErr: "template: test.json:1: missing value for if",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderTemplate("test.json", []byte(test.content))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("renderTemplate() error = %v, want %s", err, test.wantErr)
+				}
+				if line := templateErrorLine("test.json", err); strings.Contains(test.wantErr, "test.json:") && line == 0 {
+					t.Errorf("templateErrorLine() found no line in %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("renderTemplate() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateDataMissingEnvironment(t *testing.T) {
+	writeConfigDir(t, map[string]string{"vars/default.yaml": "region: us-east-1\n"})
+	setSpec(t, &Spec.Environment, "staging")
+
+	if _, err := loadTemplateData(); err == nil || !strings.Contains(err.Error(), "No variables file found for environment [staging]") {
+		t.Errorf("loadTemplateData() error = %v, want a missing environment error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"path"
+)
+
+// TokenRole is the configuration of a token role, written to
+// auth/token/roles/<name>. See https://www.vaultproject.io/api/auth/token/index.html#create-update-token-role
+// TTLs can be given as a number of seconds or a duration string (i.e. "1h")
+type TokenRole struct {
+	// Policies tokens created with the role can (or can't) be given
+	AllowedPolicies        []string `json:"allowed_policies" yaml:"allowed_policies"`
+	DisallowedPolicies     []string `json:"disallowed_policies" yaml:"disallowed_policies"`
+	AllowedPoliciesGlob    []string `json:"allowed_policies_glob,omitempty" yaml:"allowed_policies_glob"`
+	DisallowedPoliciesGlob []string `json:"disallowed_policies_glob,omitempty" yaml:"disallowed_policies_glob"`
+
+	// Create tokens without a parent, so they outlive the token that created them
+	Orphan bool `json:"orphan" yaml:"orphan"`
+
+	// Whether tokens can be renewed (defaults to true)
+	Renewable *bool `json:"renewable" yaml:"renewable"`
+
+	PathSuffix           string   `json:"path_suffix" yaml:"path_suffix"`
+	AllowedEntityAliases []string `json:"allowed_entity_aliases" yaml:"allowed_entity_aliases"`
+
+	TokenBoundCIDRs      []string `json:"token_bound_cidrs" yaml:"token_bound_cidrs"`
+	TokenExplicitMaxTTL  duration `json:"token_explicit_max_ttl" yaml:"token_explicit_max_ttl"`
+	TokenNoDefaultPolicy bool     `json:"token_no_default_policy" yaml:"token_no_default_policy"`
+	TokenNumUses         int      `json:"token_num_uses" yaml:"token_num_uses"`
+	TokenPeriod          duration `json:"token_period" yaml:"token_period"`
+	TokenType            string   `json:"token_type" yaml:"token_type"`
+}
+
+type TokenRoleList map[string]TokenRole
+
+func SyncTokenRoles() {
+
+	tokenRoleList := TokenRoleList{}
+
+	log.Info("Syncing Token Roles")
+	GetTokenRoles(tokenRoleList)
+	ConfigureTokenRoles(tokenRoleList)
+	CleanupTokenRoles(tokenRoleList)
+}
+
+func GetTokenRoles(tokenRoleList TokenRoleList) {
+	for _, entry := range loadConfigDirectory(path.Join(Spec.ConfigurationPath, "token_roles"), isConfigFile, false) {
+		content, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var role TokenRole
+		err = json.Unmarshal(content, &role)
+		if err != nil {
+			log.Fatal("Error parsing token role configuration: ", entry.Path, " ", err)
+		}
+
+		role.setDefaults()
+
+		// Use the filename (and any subdirectories) as the role name
+		tokenRoleList[entry.Name] = role
+	}
+}
+
+func (role *TokenRole) setDefaults() {
+	if role.Renewable == nil {
+		renewable := true
+		role.Renewable = &renewable
+	}
+	if role.TokenType == "" {
+		role.TokenType = "default-service"
+	}
+}
+
+func ConfigureTokenRoles(tokenRoleList TokenRoleList) {
+	for name, role := range tokenRoleList {
+		rolePath := path.Join("auth/token/roles", name)
+		task := taskWrite{
+			Path:        rolePath,
+			Description: fmt.Sprintf("Token role [%s]", rolePath),
+			Data:        structToMap(role),
+		}
+		wg.Add(1)
+		taskChan <- task
+	}
+}
+
+func CleanupTokenRoles(tokenRoleList TokenRoleList) {
+	for _, name := range getSecretList("auth/token/roles") {
+		rolePath := path.Join("auth/token/roles", name)
+		if _, ok := tokenRoleList[name]; ok {
+			log.Debugf("Token role [%s] exists in configuration, no cleanup necessary", rolePath)
+		} else {
+			task := taskDelete{
+				Description: fmt.Sprintf("Token role [%s]", rolePath),
+				Path:        rolePath,
+			}
+			taskPromptChan <- task
+		}
+	}
+}
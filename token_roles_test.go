@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenRoles(t *testing.T) {
+	writeConfigDir(t, map[string]string{
+		"token_roles/ci.yaml":          "allowed_policies: [ci]\ntoken_period: 1h\ntoken_explicit_max_ttl: 7d\nrenewable: false\n",
+		"token_roles/team/deploy.json": `{"orphan": true, "token_period": 600, "token_type": "batch"}`,
+	})
+	setSpec(t, &Spec.NameSeparator, "/")
+	vault := newTestVault(t)
+	vault.Lists["auth/token/roles"] = []string{"ci", "old"}
+	collect := captureTasks(t)
+
+	tokenRoleList := TokenRoleList{}
+	GetTokenRoles(tokenRoleList)
+	ConfigureTokenRoles(tokenRoleList)
+	CleanupTokenRoles(tokenRoleList)
+	tasks := collect()
+
+	defaults := map[string]interface{}{
+		"allowed_policies": nil, "disallowed_policies": nil, "orphan": false, "renewable": true, "path_suffix": "",
+		"allowed_entity_aliases": nil, "token_bound_cidrs": nil, "token_explicit_max_ttl": float64(0), "token_no_default_policy": false,
+		"token_num_uses": float64(0), "token_period": float64(0), "token_type": "default-service",
+	}
+	want := map[string]map[string]interface{}{
+		// Durations are written as seconds
+		"auth/token/roles/ci":          {"allowed_policies": []interface{}{"ci"}, "renewable": false, "token_period": float64(3600), "token_explicit_max_ttl": float64(604800)},
+		"auth/token/roles/team/deploy": {"orphan": true, "token_period": float64(600), "token_type": "batch"},
+	}
+	if len(tasks.writes) != len(want) {
+		t.Errorf("ConfigureTokenRoles() wrote %d roles, want %d", len(tasks.writes), len(want))
+	}
+	for rolePath, data := range want {
+		for k, v := range defaults {
+			if _, ok := data[k]; !ok {
+				data[k] = v
+			}
+		}
+		if got := tasks.writes[rolePath].Data; !reflect.DeepEqual(got, data) {
+			t.Errorf("ConfigureTokenRoles() wrote %s = %v, want %v", rolePath, got, data)
+		}
+	}
+	if !reflect.DeepEqual(tasks.deletes, []string{"auth/token/roles/old"}) {
+		t.Errorf("CleanupTokenRoles() prompted to delete %v, want [auth/token/roles/old]", tasks.deletes)
+	}
+}
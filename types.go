@@ -1,5 +1,13 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type SecretList []string
 
 func (secretList *SecretList) Add(item string) {
@@ -14,3 +22,71 @@ func (secretList SecretList) Contains(needle string) bool {
 	}
 	return false
 }
+
+// duration is a duration (i.e. a TTL) that is configured the way Vault takes
+// them: a number of seconds or a duration string ("1h", "30m", "3600", "7d").
+// It is sent to Vault as a number of seconds
+type duration time.Duration
+
+// Matches the duration strings accepted by parseDuration. Negative durations
+// are allowed, Vault takes -1 to disable the JWT/OIDC leeways
+const durationPattern = `^(-?` + durationValuePattern + `)?$`
+
+// Matches the non-negative duration strings, Vault rejects negative TTLs
+const nonNegativeDurationPattern = `^` + durationValuePattern + `?$`
+
+const durationValuePattern = `([0-9]+d?|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)`
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = duration(time.Duration(v * float64(time.Second)))
+	case string:
+		parsed, err := parseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration [%s], expected a number of seconds or a duration string", string(data))
+	}
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int64(time.Duration(d) / time.Second))
+}
+
+// parseDuration parses a duration the same way as Vault: a number of
+// seconds, a number of days ("7d") or a Go duration string ("1h30m")
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration [%s]", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration [%s]", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "3600", want: time.Hour},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "1.5h", want: 90 * time.Minute},
+		{value: "-1", want: -time.Second},
+		{value: "-1h", want: -time.Hour},
+		{value: "-2d", want: -48 * time.Hour},
+		{value: "1 hour", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "-", wantErr: true},
+	}
+
+	pattern := regexp.MustCompile(durationPattern)
+	nonNegativePattern := regexp.MustCompile(nonNegativeDurationPattern)
+	for _, test := range tests {
+		got, err := parseDuration(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseDuration(%s) = %v, %v, want %v, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+
+		// The schema patterns accept the same strings, without the negative
+		// ones for nonNegativeDurationPattern
+		if matched := pattern.MatchString(test.value); matched == test.wantErr {
+			t.Errorf("durationPattern matches [%s] = %v, want %v", test.value, matched, !test.wantErr)
+		}
+		if matched, want := nonNegativePattern.MatchString(test.value), !test.wantErr && got >= 0; matched != want {
+			t.Errorf("nonNegativeDurationPattern matches [%s] = %v, want %v", test.value, matched, want)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    duration
+		wantErr bool
+	}{
+		{value: `null`, want: 0},
+		{value: `3600`, want: duration(time.Hour)},
+		{value: `-1`, want: duration(-time.Second)},
+		{value: `"1h"`, want: duration(time.Hour)},
+		{value: `"7d"`, want: duration(7 * 24 * time.Hour)},
+		{value: `"-1"`, want: duration(-time.Second)},
+		{value: `"1 hour"`, wantErr: true},
+		{value: `true`, wantErr: true},
+		{value: `["1h"]`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		var got duration
+		err := json.Unmarshal([]byte(test.value), &got)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v, error %v", test.value, time.Duration(got), err, time.Duration(test.want), test.wantErr)
+		}
+	}
+
+	// Durations are sent to Vault as a number of seconds
+	marshalTests := []struct {
+		value duration
+		want  string
+	}{
+		{value: 0, want: `0`},
+		{value: duration(90 * time.Minute), want: `5400`},
+		{value: duration(-time.Second), want: `-1`},
+		{value: duration(1500 * time.Millisecond), want: `1`},
+	}
+
+	for _, test := range marshalTests {
+		got, err := json.Marshal(test.value)
+		if err != nil || string(got) != test.want {
+			t.Errorf("Marshal(%v) = %s, %v, want %s", time.Duration(test.value), got, err, test.want)
+		}
+	}
+}
@@ -2,28 +2,33 @@ package main
 
 import (
 	"encoding/json"
-	// "gopkg.in/yaml.v2"
 	"errors"
 	"fmt"
+	VaultApi "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-func getJsonFile(path string) (bool, string) {
-	if checkExt(path, ".json") {
-		content, err := ioutil.ReadFile(path)
+// Extensions of files that can be used for configuration
+var configFileExtensions = []string{".json", ".yaml", ".yml"}
+
+// getConfigFile reads in a JSON or YAML configuration file and returns its
+// content as JSON
+func getConfigFile(path string) (bool, string) {
+	if isConfigFile(path) {
+		content, err := readConfigFile(path)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if !isJSON(string(content)) {
-			log.Fatal("File is not valid JSON: ", path)
-		}
-
 		return true, string(content)
 	} else {
 		log.Warn("File has wrong extension.  Will not be processed: ", path)
@@ -31,31 +36,159 @@ func getJsonFile(path string) (bool, string) {
 	}
 }
 
-func getSecretArray(path string) (bool, map[string]string) {
+// readConfigFile reads in a JSON or YAML configuration file and returns its
+// content as JSON. The template stage is run first and then YAML is converted
+// so the rest of the processing is the same for both formats
+func readConfigFile(filePath string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file [%s]: %v", filePath, err)
+	}
 
-	var secretArray map[string]string
-	secretArray = make(map[string]string)
+	content, err = renderTemplate(filePath, content)
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering template [%s]: %v", filePath, err)
+	}
 
-	// Read secrets from Vault for substitution
-	secret, err := Vault.Read(path)
+	if checkExt(filePath, ".json") {
+		if !isJSON(string(content)) {
+			return nil, fmt.Errorf("Configuration file [%s] is not valid JSON", filePath)
+		}
+		registerConfigSensitiveFields(content)
+		return content, nil
+	}
+
+	jsonContent, err := yamlToJSON(content)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("Configuration file [%s] is not valid: %v", filePath, err)
 	}
 
-	if secret != nil {
-		for k, v := range secret.Data {
-			switch value := v.(type) {
-			case string:
-				secretArray[k] = value
-			default:
-				log.Fatal("Issue parsing Vault secret [" + path + "]")
+	registerConfigSensitiveFields(jsonContent)
+	return jsonContent, nil
+}
+
+// findConfigFile returns the path to a configuration file in a directory by
+// its name without extension (i.e. config for config.json or config.yaml)
+func findConfigFile(dirPath string, name string) (string, bool) {
+	for _, ext := range configFileExtensions {
+		filePath := path.Join(dirPath, name+ext)
+		if _, err := os.Stat(filePath); err == nil {
+			return filePath, true
+		}
+	}
+
+	return path.Join(dirPath, name+configFileExtensions[0]), false
+}
+
+// isConfigFile returns whether the file has one of the configuration file extensions
+func isConfigFile(filename string) bool {
+	for _, ext := range configFileExtensions {
+		if checkExt(filename, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kvMount is the KV secrets engine mount containing the secret base path
+type kvMount struct {
+	Path    string
+	Version int
+}
+
+var secretBaseMount kvMount
+var secretBaseMountOnce sync.Once
+
+// getSecretBaseMount looks up the mount of the secret base path to find which
+// version of the KV secrets engine it is. If the lookup isn't possible (i.e.
+// the token doesn't have permission) version 1 is assumed
+func getSecretBaseMount() kvMount {
+	secretBaseMountOnce.Do(func() {
+		secretBaseMount = lookupKVMount(Spec.VaultSecretBasePath)
+
+		if Spec.SecretVersion != "" {
+			if secretBaseMount.Version != 2 {
+				log.Fatalf("Secret version [%s] can only be used when the secret base path [%s] is a KV version 2 mount", Spec.SecretVersion, Spec.VaultSecretBasePath)
+			}
+			if _, err := strconv.Atoi(Spec.SecretVersion); err != nil {
+				log.Fatalf("Invalid value '%v' for secret version", Spec.SecretVersion)
 			}
 		}
+	})
+
+	return secretBaseMount
+}
+
+// lookupKVMount finds the KV secrets engine mount of a path and its version.
+// If the lookup isn't possible version 1 is assumed
+func lookupKVMount(secretPath string) kvMount {
+	mount := kvMount{Version: 1}
+
+	secret, err := Vault.Read(path.Join("sys/internal/ui/mounts", secretPath))
+	if err != nil || secret == nil {
+		log.Debugf("Unable to look up the mount for path [%s], assuming KV version 1: %v", secretPath, err)
+		return mount
+	}
+
+	if mountPath, ok := secret.Data["path"].(string); ok {
+		mount.Path = mountPath
+	}
+	if options, ok := secret.Data["options"].(map[string]interface{}); ok && options["version"] == "2" {
+		mount.Version = 2
+	}
+	log.Debugf("Path [%s] is in KV version %d mount [%s]", secretPath, mount.Version, mount.Path)
+
+	return mount
+}
+
+// writeKVSecret writes a secret to a KV secrets engine of either version
+func writeKVSecret(secretPath string, data map[string]interface{}) error {
+	mount := lookupKVMount(secretPath)
+	if mount.Version == 2 {
+		secretPath = path.Join(mount.Path, "data", strings.TrimPrefix(secretPath, mount.Path))
+		data = map[string]interface{}{"data": data}
+	}
+
+	_, err := Vault.Write(secretPath, data)
+	return err
+}
+
+func getSecretArray(secretPath string) (bool, map[string]interface{}) {
+
+	// Read secrets from Vault for substitution. KV version 2 secrets are read
+	// from the data/ path and can be pinned to a version
+	var secret *VaultApi.Secret
+	var err error
+	mount := getSecretBaseMount()
+	if mount.Version == 2 {
+		secretPath = path.Join(mount.Path, "data", strings.TrimPrefix(secretPath, mount.Path))
+		var data map[string][]string
+		if Spec.SecretVersion != "" {
+			data = map[string][]string{"version": {Spec.SecretVersion}}
+		}
+		secret, err = Vault.ReadWithData(secretPath, data)
 	} else {
+		secret, err = Vault.Read(secretPath)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if secret == nil {
 		return false, nil
 	}
 
-	return true, secretArray
+	secretData := secret.Data
+	if mount.Version == 2 {
+		// Deleted or destroyed versions have no data
+		var ok bool
+		if secretData, ok = secret.Data["data"].(map[string]interface{}); !ok {
+			return false, nil
+		}
+	}
+
+	return true, secretData
 }
 
 // GetSecretListKeyInfo takes a path and performs a LIST operation on it
@@ -131,31 +264,6 @@ func getSecretList(path string) SecretList {
 	return secretList
 }
 
-func performSubstitutions(content *string, secretPath string) (bool, string) {
-
-	var secrets map[string]string
-	success, secrets := getSecretArray(Spec.VaultSecretBasePath + secretPath)
-
-	if success {
-		for k, v := range secrets {
-			*content = strings.Replace(*content, "%{"+k+"}%", v, -1)
-		}
-	}
-
-	// Ensure all the variables were substituted
-	re := regexp.MustCompile("(%\\{[a-zA-Z0-9_]+\\}%)")
-	matches := re.FindAllStringSubmatch(*content, -1)
-	if len(matches) > 0 {
-		var matchArray []string
-		for _, match := range matches {
-			matchArray = append(matchArray, match[0])
-		}
-		return false, fmt.Sprintf("The following substitutions were detected but not found in Vault path ["+secretPath+"]: %v", strings.Join(matchArray, ", "))
-	}
-
-	return true, ""
-}
-
 func checkExt(filename string, ext string) bool {
 	if filepath.Ext(filename) == ext {
 		return true
@@ -170,10 +278,54 @@ func isJSON(s string) bool {
 }
 
 func isYAML(s string) (bool, error) {
-	// var x map[string]interface{}
-	// err := yaml.Unmarshal([]byte(s), &x)
-	// return err == nil, err
-	return false, errors.New("YAML is not yet supported")
+	var x map[string]interface{}
+	err := yaml.Unmarshal([]byte(s), &x)
+	return err == nil, err
+}
+
+// yamlToJSON converts a YAML document to JSON. Anchors, aliases and merge keys
+// are resolved as part of the conversion
+func yamlToJSON(content []byte) ([]byte, error) {
+	var x map[string]interface{}
+	if err := yaml.Unmarshal(content, &x); err != nil {
+		return nil, err
+	}
+
+	jsonContent, err := json.Marshal(yamlStringKeys(x))
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonContent, nil
+}
+
+// yamlStringKeys converts the keys of nested YAML mappings to strings. YAML
+// keys can be any scalar (i.e. an unquoted number) but JSON keys are strings
+func yamlStringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = yamlStringKeys(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = yamlStringKeys(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = yamlStringKeys(item)
+		}
+		return result
+	}
+	return value
 }
 
 func askForConfirmation(msg string, max int) bool {
@@ -223,38 +375,187 @@ func processDirectoryRaw(dirPath string) map[string][]byte {
 
 	results := make(map[string][]byte)
 
-	files, err := ioutil.ReadDir(dirPath)
-	if err != nil {
-		log.Warnf("Error reading configuration directory [%s]: %v", dirPath, err)
+	for _, entry := range loadConfigDirectory(dirPath, isConfigFile, false) {
+		fileContent, err := readConfigFile(entry.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		results[entry.Name] = fileContent
 	}
 
-	for _, file := range files {
-		filePath := path.Join(dirPath, file.Name())
-		fileExtension := filepath.Ext(file.Name())
-		if fileExtension == ".json" || fileExtension == ".yaml" {
-			fileContent, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				log.Fatalf("Error reading file [%s]: %v", filePath, err)
-			}
+	return results
+}
+
+// configEntry is a configuration file found in a configuration directory
+type configEntry struct {
+	// Name of the item, from the file's path relative to the directory
+	Name string
+	Path string
+}
 
-			fileStringContent := string(fileContent)
-			if fileExtension == ".json" && !isJSON(fileStringContent) {
-				log.Fatalf("Configuration file [%s] is not valid JSON", filePath)
+// walkConfigDirectory finds the configuration files in a directory and its
+// subdirectories. Subdirectories become part of the item name, joined with
+// --name-separator, or are only used for organisation if
+// --flatten-directories is set. If skipItemDirs is set, subdirectories with
+// the same name as a file next to them (i.e. approle/ next to approle.json)
+// hold data for that item and are skipped. Files that don't pass isValidFile
+// are returned separately so they can be reported
+func walkConfigDirectory(dirPath string, isValidFile func(string) bool, skipItemDirs bool) ([]configEntry, []string, error) {
+
+	var entries []configEntry
+	var skipped []string
+	names := make(map[string]string)
+
+	var walk func(dir string, prefix []string) error
+	walk = func(dir string, prefix []string) error {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		itemNames := SecretList{}
+		for _, file := range files {
+			if !file.IsDir() && isValidFile(file.Name()) {
+				itemNames.Add(fileBaseName(file.Name()))
 			}
-			if fileExtension == ".yaml" {
-				_, err := isYAML(fileStringContent)
-				if err != nil {
-					log.Fatalf("Configuration file [%s] is not valid: %v", filePath, err)
+		}
+
+		for _, file := range files {
+			filePath := path.Join(dir, file.Name())
+			if file.IsDir() {
+				if skipItemDirs && itemNames.Contains(file.Name()) {
+					continue
+				}
+				if err := walk(filePath, append(prefix, file.Name())); err != nil {
+					return err
 				}
+				continue
 			}
 
-			itemName := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
-			results[itemName] = fileContent
+			if !isValidFile(file.Name()) {
+				skipped = append(skipped, filePath)
+				continue
+			}
 
-		} else {
-			log.Warnf("Configuration file [%s] does not have valid json/yaml extension and will not be processed", filePath)
+			name := configItemName(prefix, fileBaseName(file.Name()))
+			if existing, ok := names[name]; ok {
+				return fmt.Errorf("[%s] and [%s] both have the name [%s]", existing, filePath, name)
+			}
+			names[name] = filePath
+			entries = append(entries, configEntry{Name: name, Path: filePath})
 		}
+
+		return nil
 	}
 
-	return results
+	err := walk(dirPath, nil)
+	return entries, skipped, err
+}
+
+// loadConfigDirectory walks a configuration directory for a sync. Files with
+// the wrong extension are skipped with a warning, as is a missing directory
+func loadConfigDirectory(dirPath string, isValidFile func(string) bool, skipItemDirs bool) []configEntry {
+	entries, skipped, err := walkConfigDirectory(dirPath, isValidFile, skipItemDirs)
+	if os.IsNotExist(err) {
+		log.Warnf("Error reading configuration directory [%s]: %v", dirPath, err)
+	} else if err != nil {
+		log.Fatalf("Error reading configuration directory [%s]: %v", dirPath, err)
+	}
+
+	for _, filePath := range skipped {
+		log.Warnf("Configuration file [%s] does not have a valid extension and will not be processed", filePath)
+	}
+
+	return entries
+}
+
+// fileBaseName returns the name of a file without its directory or extension
+func fileBaseName(filePath string) string {
+	return strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+}
+
+// configItemName builds the name of a configuration item from the
+// subdirectories it is in and its own name
+func configItemName(dirs []string, name string) string {
+	if Spec.FlattenDirectories {
+		return name
+	}
+	return strings.Join(append(append([]string{}, dirs...), name), Spec.NameSeparator)
+}
+
+// Temporary directories that the configuration has been composed in (i.e. an
+// expanded bundle), removed once the run is complete
+var tempConfigurationDirs []string
+
+// newTempConfigurationDir creates a temporary directory for the configuration
+func newTempConfigurationDir(prefix string) string {
+	dirPath, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		log.Fatal("Unable to create temporary configuration directory: ", err)
+	}
+
+	if len(tempConfigurationDirs) == 0 {
+		log.RegisterExitHandler(cleanupTempConfigurationDirs)
+	}
+	tempConfigurationDirs = append(tempConfigurationDirs, dirPath)
+
+	return dirPath
+}
+
+// cleanupTempConfigurationDirs removes the temporary configuration directories
+func cleanupTempConfigurationDirs() {
+	for _, dirPath := range tempConfigurationDirs {
+		os.RemoveAll(dirPath)
+	}
+	tempConfigurationDirs = nil
+}
+
+// Labels for the paths of temporary configuration files, so problems are
+// reported against where the configuration came from
+var configurationPathLabels = make(map[string]string)
+var configurationPathReplacer = strings.NewReplacer()
+var configurationPathHookOnce sync.Once
+
+// labelConfigurationPaths adds labels for configuration paths. The paths are
+// replaced with their label in all log messages
+func labelConfigurationPaths(labels map[string]string) {
+	for filePath, label := range labels {
+		configurationPathLabels[filePath] = label
+	}
+
+	// Replace the longest paths first so a directory doesn't match a file
+	filePaths := make([]string, 0, len(configurationPathLabels))
+	for filePath := range configurationPathLabels {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Slice(filePaths, func(i, j int) bool { return len(filePaths[i]) > len(filePaths[j]) })
+
+	var replacements []string
+	for _, filePath := range filePaths {
+		replacements = append(replacements, filePath, configurationPathLabels[filePath])
+	}
+	configurationPathReplacer = strings.NewReplacer(replacements...)
+
+	configurationPathHookOnce.Do(func() {
+		log.AddHook(configurationPathHook{})
+	})
+}
+
+// configurationPathLabel returns the label for a configuration path
+func configurationPathLabel(filePath string) string {
+	return configurationPathReplacer.Replace(filePath)
+}
+
+// configurationPathHook is a logrus hook that replaces the labelled
+// configuration paths in log messages
+type configurationPathHook struct{}
+
+func (h configurationPathHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h configurationPathHook) Fire(entry *log.Entry) error {
+	entry.Message = configurationPathReplacer.Replace(entry.Message)
+	return nil
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestYamlToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "scalars and lists",
+			yaml: "name: app\ncount: 2\nenabled: true\nttl: 1h\npolicies:\n  - a\n  - b\n",
+			want: `{"count":2,"enabled":true,"name":"app","policies":["a","b"],"ttl":"1h"}`,
+		},
+		{
+			name: "anchors and merge keys",
+			yaml: "base: &base\n  ttl: 1h\n  policies: [a]\nrole:\n  <<: *base\n  ttl: 2h\n",
+			want: `{"base":{"policies":["a"],"ttl":"1h"},"role":{"policies":["a"],"ttl":"2h"}}`,
+		},
+		{
+			name: "non-string keys",
+			yaml: "additional_config:\n  policy_map:\n    1234: [a]\n    true: [b]\n  nested:\n    - 1: one\n",
+			want: `{"additional_config":{"nested":[{"1":"one"}],"policy_map":{"1234":["a"],"true":["b"]}}}`,
+		},
+		{
+			name: "empty",
+			yaml: "",
+			want: `null`,
+		},
+		{
+			name:    "not a mapping",
+			yaml:    "- a\n- b\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			yaml:    "name: [a\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(test.yaml))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("yamlToJSON() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && string(got) != test.want {
+				t.Errorf("yamlToJSON() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLookupKVMount(t *testing.T) {
+	vault := newTestVault(t)
+	vault.Data["sys/internal/ui/mounts/kv/vault-admin"] = map[string]interface{}{"path": "kv/", "type": "kv", "options": map[string]interface{}{"version": "2"}}
+	vault.Data["sys/internal/ui/mounts/secret/vault-admin"] = map[string]interface{}{"path": "secret/", "type": "kv", "options": map[string]interface{}{"version": "1"}}
+
+	tests := []struct {
+		path string
+		want kvMount
+	}{
+		{path: "kv/vault-admin", want: kvMount{Path: "kv/", Version: 2}},
+		{path: "secret/vault-admin", want: kvMount{Path: "secret/", Version: 1}},
+		// Version 1 is assumed when the mount can't be looked up
+		{path: "other/vault-admin", want: kvMount{Version: 1}},
+	}
+
+	for _, test := range tests {
+		if got := lookupKVMount(test.path); got != test.want {
+			t.Errorf("lookupKVMount(%s) = %+v, want %+v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestKVSecrets(t *testing.T) {
+	tests := []struct {
+		name      string
+		basePath  string
+		version   string
+		mount     map[string]interface{}
+		secrets   map[string]map[string]interface{}
+		wantRead  string
+		wantWrite string
+		wantData  map[string]interface{}
+	}{
+		{
+			name:      "version 1",
+			basePath:  "secret/vault-admin/",
+			secrets:   map[string]map[string]interface{}{"secret/vault-admin/auth/ldap": {"BINDPASS": "v1"}},
+			wantRead:  "secret/vault-admin/auth/ldap",
+			wantWrite: "secret/vault-admin/passwords/a",
+			wantData:  map[string]interface{}{"BINDPASS": "v1"},
+		},
+		{
+			name:      "version 2",
+			basePath:  "kv/vault-admin/",
+			mount:     map[string]interface{}{"path": "kv/", "options": map[string]interface{}{"version": "2"}},
+			secrets:   map[string]map[string]interface{}{"kv/data/vault-admin/auth/ldap": {"data": map[string]interface{}{"BINDPASS": "v2"}}},
+			wantRead:  "kv/data/vault-admin/auth/ldap",
+			wantWrite: "kv/data/vault-admin/passwords/a",
+			wantData:  map[string]interface{}{"BINDPASS": "v2"},
+		},
+		{
+			name:      "version 2 pinned",
+			basePath:  "kv/vault-admin/",
+			version:   "3",
+			mount:     map[string]interface{}{"path": "kv/", "options": map[string]interface{}{"version": "2"}},
+			secrets:   map[string]map[string]interface{}{"kv/data/vault-admin/auth/ldap": {"data": map[string]interface{}{"BINDPASS": "v2"}}},
+			wantRead:  "kv/data/vault-admin/auth/ldap?version=3",
+			wantWrite: "kv/data/vault-admin/passwords/a",
+			wantData:  map[string]interface{}{"BINDPASS": "v2"},
+		},
+		{
+			name:      "version 2 deleted",
+			basePath:  "kv/vault-admin/",
+			mount:     map[string]interface{}{"path": "kv/", "options": map[string]interface{}{"version": "2"}},
+			secrets:   map[string]map[string]interface{}{"kv/data/vault-admin/auth/ldap": {"data": nil}},
+			wantRead:  "kv/data/vault-admin/auth/ldap",
+			wantWrite: "kv/data/vault-admin/passwords/a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vault := newTestVault(t)
+			for secretPath, data := range test.secrets {
+				vault.Data[secretPath] = data
+			}
+			if test.mount != nil {
+				for _, p := range []string{test.basePath, test.basePath + "passwords/a"} {
+					vault.Data[path.Join("sys/internal/ui/mounts", p)] = test.mount
+				}
+			}
+			setSpec(t, &Spec.VaultSecretBasePath, test.basePath)
+			setSpec(t, &Spec.SecretVersion, test.version)
+			secretBaseMountOnce = sync.Once{}
+			defer func() { secretBaseMountOnce = sync.Once{} }()
+
+			found, data := getSecretArray(test.basePath + "auth/ldap")
+			if found != (test.wantData != nil) || !reflect.DeepEqual(data, test.wantData) {
+				t.Errorf("getSecretArray() = %v, %v, want %v", found, data, test.wantData)
+			}
+			if reads := vault.requests("GET"); !SecretList(reads).Contains(test.wantRead) {
+				t.Errorf("getSecretArray() read %v, want %s", reads, test.wantRead)
+			}
+
+			if err := writeKVSecret(test.basePath+"passwords/a", map[string]interface{}{"password": "p"}); err != nil {
+				t.Fatal(err)
+			}
+			if writes := vault.requests("PUT"); !reflect.DeepEqual(writes, []string{test.wantWrite}) {
+				t.Errorf("writeKVSecret() wrote %v, want %s", writes, test.wantWrite)
+			}
+		})
+	}
+}
+
+func TestWalkConfigDirectory(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []string
+		flatten      bool
+		skipItemDirs bool
+		want         []configEntry
+		wantSkipped  []string
+		wantErr      string
+	}{
+		{
+			name:        "subdirectories",
+			files:       []string{"a.json", "team/b.yaml", "team/sub/c.yml", "notes.txt"},
+			want:        []configEntry{{Name: "a", Path: "a.json"}, {Name: "team-b", Path: "team/b.yaml"}, {Name: "team-sub-c", Path: "team/sub/c.yml"}},
+			wantSkipped: []string{"notes.txt"},
+		},
+		{
+			name:    "flattened",
+			files:   []string{"a.json", "team/b.yaml"},
+			flatten: true,
+			want:    []configEntry{{Name: "a", Path: "a.json"}, {Name: "b", Path: "team/b.yaml"}},
+		},
+		{
+			name:         "item directories",
+			files:        []string{"approle.json", "approle/roles/a.json", "team/b.json"},
+			skipItemDirs: true,
+			want:         []configEntry{{Name: "approle", Path: "approle.json"}, {Name: "team-b", Path: "team/b.json"}},
+		},
+		{
+			name:    "duplicate extensions",
+			files:   []string{"a.json", "a.yaml"},
+			wantErr: "a.json] and [",
+		},
+		{
+			name:    "duplicate flattened names",
+			files:   []string{"a/c.json", "b/c.json"},
+			flatten: true,
+			wantErr: "both have the name [c]",
+		},
+		{
+			name:    "duplicate separated names",
+			files:   []string{"a-b.json", "a/b.json"},
+			wantErr: "both have the name [a-b]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for _, file := range test.files {
+				files[file] = "{}"
+			}
+			dir := writeConfigDir(t, files)
+			setSpec(t, &Spec.NameSeparator, "-")
+			previous := Spec.FlattenDirectories
+			Spec.FlattenDirectories = test.flatten
+			defer func() { Spec.FlattenDirectories = previous }()
+
+			entries, skipped, err := walkConfigDirectory(dir, isConfigFile, test.skipItemDirs)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("walkConfigDirectory() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range entries {
+				entries[i].Path = strings.TrimPrefix(entries[i].Path, dir+"/")
+			}
+			for i := range skipped {
+				skipped[i] = strings.TrimPrefix(skipped[i], dir+"/")
+			}
+			if !reflect.DeepEqual(entries, test.want) || !reflect.DeepEqual(skipped, test.wantSkipped) {
+				t.Errorf("walkConfigDirectory() = %v, %v, want %v, %v", entries, skipped, test.want, test.wantSkipped)
+			}
+		})
+	}
+}
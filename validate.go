@@ -0,0 +1,930 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PremiereGlobal/vault-admin/pkg/secrets-engines/identity"
+	VaultApi "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Known mount types. Unknown auth method and secrets engine types only produce
+// a warning since they could be custom plugins
+var knownAuditDeviceTypes = SecretList{"file", "socket", "syslog"}
+var knownAuthMethodTypes = SecretList{"alicloud", "app-id", "approle", "aws", "azure", "cert", "cf", "gcp", "github", "jwt", "kerberos", "kubernetes", "ldap", "oci", "oidc", "okta", "radius", "token", "userpass"}
+var knownSecretsEnginesTypes = SecretList{"ad", "alicloud", "aws", "azure", "cassandra", "consul", "database", "gcp", "gcpkms", "generic", "kmip", "kv", "mongodb", "mongodbatlas", "mssql", "mysql", "nomad", "openldap", "pki", "postgresql", "rabbitmq", "ssh", "totp", "transform", "transit"}
+
+// Policies that exist in every Vault and are never part of the configuration
+var builtinPolicies = SecretList{"default", "root"}
+
+// Valid AWS secrets engine credential types
+var awsCredentialTypes = SecretList{"iam_user", "assumed_role", "federation_token"}
+
+// configProblem is a single issue found while validating the configuration
+type configProblem struct {
+	Warning bool
+	File    string
+	Line    int
+	Message string
+}
+
+// configFile is a configuration file read in for validation
+type configFile struct {
+	Path    string
+	Content []byte
+
+	// Name of the item configured by the file, from its path within the
+	// configuration directory
+	Name string
+
+	// Content of the file as JSON (YAML files are converted)
+	JSON []byte
+
+	// Parsed node tree of the file, used to look up line numbers. JSON is a
+	// subset of YAML so this works for both
+	root *yaml.Node
+}
+
+// configReference is a reference from one configuration item to another
+// (policies, auth mounts, groups) that needs to be checked once the whole
+// configuration has been loaded
+type configReference struct {
+	Name        string
+	File        *configFile
+	Line        int
+	Description string
+}
+
+type configValidator struct {
+	problems []configProblem
+
+	// Items found in the configuration
+	policies   SecretList
+	authMounts SecretList
+	groups     SecretList
+
+	// References to items that must exist in the configuration
+	policyRefs []configReference
+	mountRefs  []configReference
+	groupRefs  []configReference
+}
+
+// ValidateConfiguration loads the entire configuration, without connecting to
+// Vault, and reports every problem found
+func ValidateConfiguration() {
+
+	log.Infof("Validating configuration [%s]", Spec.ConfigurationPath)
+
+	v := configValidator{}
+	v.validate()
+
+	errorCount := v.report()
+	if errorCount > 0 {
+		log.Fatalf("Configuration is invalid, %d error(s) found", errorCount)
+	}
+
+	log.Info("Configuration is valid")
+}
+
+// validate checks every part of the configuration, recording the problems found
+func (v *configValidator) validate() {
+	if _, err := getTemplateData(); err != nil {
+		v.errorf(&configFile{Path: path.Join(Spec.ConfigurationPath, "vars")}, 0, "%v", err)
+	}
+	v.validateAuditDevices()
+	v.validateAuthMethods()
+	v.validatePolicies()
+	v.validateTokenRoles()
+	v.validateSecretsEngines()
+	v.checkReferences()
+}
+
+func (v *configValidator) errorf(file *configFile, line int, format string, args ...interface{}) {
+	v.problems = append(v.problems, configProblem{File: file.Path, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *configValidator) warnf(file *configFile, line int, format string, args ...interface{}) {
+	v.problems = append(v.problems, configProblem{Warning: true, File: file.Path, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// report logs all the problems found, ordered by file and line, and returns
+// the number of errors
+func (v *configValidator) report() int {
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].File != v.problems[j].File {
+			return v.problems[i].File < v.problems[j].File
+		}
+		return v.problems[i].Line < v.problems[j].Line
+	})
+
+	errorCount := 0
+	for _, problem := range v.problems {
+		if problem.Warning {
+			log.Warnf("%s:%d: %s", problem.File, problem.Line, problem.Message)
+		} else {
+			log.Errorf("%s:%d: %s", problem.File, problem.Line, problem.Message)
+			errorCount++
+		}
+	}
+
+	return errorCount
+}
+
+// readFile reads in a single configuration file. If the file doesn't exist
+// and is required an error is reported
+func (v *configValidator) readFile(filePath string, required bool) *configFile {
+
+	file := &configFile{Path: filePath}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if required || !os.IsNotExist(err) {
+			v.errorf(file, 0, "Unable to read configuration file: %v", err)
+		}
+		return nil
+	}
+
+	content, err = renderTemplate(filePath, content)
+	if err != nil {
+		v.errorf(file, templateErrorLine(filePath, err), "Invalid template: %v", err)
+		return nil
+	}
+	file.Content = content
+
+	if checkExt(filePath, ".json") {
+		file.JSON = content
+	} else {
+		file.JSON, err = yamlToJSON(content)
+		if err != nil {
+			v.errorf(file, yamlErrorLine(err), "Invalid YAML: %v", err)
+			return nil
+		}
+	}
+
+	// Errors are ignored here, JSON syntax errors are reported when the file is decoded
+	var root yaml.Node
+	if yaml.Unmarshal(content, &root) == nil {
+		file.root = &root
+	}
+
+	return file
+}
+
+// readConfigFile reads in a configuration file by its name without extension
+func (v *configValidator) readConfigFile(dirPath string, name string, required bool) *configFile {
+	filePath, ok := findConfigFile(dirPath, name)
+	if !ok && !required {
+		return nil
+	}
+
+	return v.readFile(filePath, required)
+}
+
+// readDir reads in all the configuration files in a directory and its
+// subdirectories. Files that would be skipped during a sync are reported as
+// warnings
+func (v *configValidator) readDir(dirPath string, required bool, skipItemDirs bool) []*configFile {
+
+	var configFiles []*configFile
+
+	entries, skipped, err := v.walkDir(dirPath, required, isConfigFile, skipItemDirs)
+	for _, filePath := range skipped {
+		v.warnf(&configFile{Path: filePath}, 0, "File does not have a valid extension (%s) and will not be processed", strings.Join(configFileExtensions, ", "))
+	}
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		if f := v.readFile(entry.Path, true); f != nil {
+			f.Name = entry.Name
+			configFiles = append(configFiles, f)
+		}
+	}
+
+	return configFiles
+}
+
+// walkDir walks a configuration directory the same way as a sync, reporting
+// any errors
+func (v *configValidator) walkDir(dirPath string, required bool, isValidFile func(string) bool, skipItemDirs bool) ([]configEntry, []string, error) {
+	entries, skipped, err := walkConfigDirectory(dirPath, isValidFile, skipItemDirs)
+	if err != nil && (required || !os.IsNotExist(err)) {
+		v.errorf(&configFile{Path: dirPath}, 0, "Unable to read configuration directory: %v", err)
+	}
+	return entries, skipped, err
+}
+
+// decode validates a configuration file against the named schema and then
+// unmarshalls it into the given type. Any problems are reported with the line
+// they occurred on
+func (v *configValidator) decode(file *configFile, schemaName string, target interface{}) bool {
+
+	var value interface{}
+	if err := json.Unmarshal(file.JSON, &value); err != nil {
+		if e, ok := err.(*json.SyntaxError); ok {
+			v.errorf(file, file.offsetLine(e.Offset), "Invalid JSON: %v", e)
+		} else {
+			v.errorf(file, 0, "Unable to parse configuration file: %v", err)
+		}
+		return false
+	}
+
+	schemaErrors := validateSchema(getConfigSchema(schemaName), value, nil)
+	for _, e := range schemaErrors {
+		if e.Warning {
+			v.warnf(file, file.line(e.Path...), "%s", e.Message)
+		} else {
+			v.errorf(file, file.line(e.Path...), "%s", e.Message)
+		}
+	}
+
+	// The schema should catch everything that would fail here, but in case it
+	// doesn't make sure the error is still reported. Typed placeholders can be
+	// any type so are left unset
+	err := json.Unmarshal(typedSubstitutionRegex.ReplaceAll(file.JSON, []byte("null")), target)
+	if err != nil && !hasSchemaErrors(schemaErrors) {
+		if e, ok := err.(*json.UnmarshalTypeError); ok {
+			v.errorf(file, file.offsetLine(e.Offset), "Invalid value for '%s': expected %s but got %s", e.Field, e.Type.String(), e.Value)
+		} else {
+			v.errorf(file, 0, "Unable to parse configuration file: %v", err)
+		}
+	}
+
+	return err == nil && !hasSchemaErrors(schemaErrors)
+}
+
+// applyExtends resolves the templates extended by a configuration file before
+// it is decoded. Fields from templates are reported against the extends line
+func (v *configValidator) applyExtends(file *configFile, kind string) bool {
+	resolved, err := applyExtends(kind, file.JSON)
+	if err != nil {
+		v.errorf(file, file.line("extends"), "%v", err)
+		return false
+	}
+	file.JSON = resolved
+	return true
+}
+
+// applyRoleListExtends resolves the templates extended by each of the JWT/OIDC
+// roles in an auth method's additional_config
+func (v *configValidator) applyRoleListExtends(file *configFile) bool {
+	var config map[string]interface{}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return true
+	}
+
+	additionalConfig, ok := config["additional_config"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	if roles, ok := additionalConfig["roles"].([]interface{}); ok {
+		for i, role := range roles {
+			if m, ok := role.(map[string]interface{}); ok {
+				resolved, err := resolveExtends(templateKindJWTRoles, m, nil)
+				if err != nil {
+					v.errorf(file, file.line("additional_config", "roles", i, "extends"), "%v", err)
+					return false
+				}
+				roles[i] = resolved
+			}
+		}
+	}
+
+	resolved, err := json.Marshal(config)
+	if err != nil {
+		return true
+	}
+	file.JSON = resolved
+	return true
+}
+
+// addPolicyRefs records the policies referenced by a configuration item. The
+// value can either be a list or a comma separated string of policy names
+func (v *configValidator) addPolicyRefs(file *configFile, line int, description string, value interface{}) {
+	switch policies := value.(type) {
+	case nil:
+	case string:
+		for _, policy := range strings.Split(policies, ",") {
+			if policy = strings.TrimSpace(policy); policy != "" {
+				v.policyRefs = append(v.policyRefs, configReference{Name: policy, File: file, Line: line, Description: description})
+			}
+		}
+	case []string:
+		for _, policy := range policies {
+			v.policyRefs = append(v.policyRefs, configReference{Name: policy, File: file, Line: line, Description: description})
+		}
+	case []interface{}:
+		for _, p := range policies {
+			if policy, ok := p.(string); ok {
+				v.policyRefs = append(v.policyRefs, configReference{Name: policy, File: file, Line: line, Description: description})
+			} else {
+				v.errorf(file, line, "%s has an invalid policy name [%v]", description, p)
+			}
+		}
+	default:
+		v.errorf(file, line, "%s policies must be a list of policy names", description)
+	}
+}
+
+// checkReferences ensures that all referenced policies, auth mounts and groups
+// exist in the configuration
+func (v *configValidator) checkReferences() {
+	for _, ref := range v.policyRefs {
+		if !v.policies.Contains(ref.Name) && !builtinPolicies.Contains(ref.Name) {
+			v.errorf(ref.File, ref.Line, "%s references policy [%s] which does not exist in configuration", ref.Description, ref.Name)
+		}
+	}
+
+	for _, ref := range v.mountRefs {
+		if !v.authMounts.Contains(ref.Name) {
+			v.errorf(ref.File, ref.Line, "%s references auth mount_path [%s] which does not exist in configuration. Ensure it is in the format '<path>/'", ref.Description, ref.Name)
+		}
+	}
+
+	for _, ref := range v.groupRefs {
+		if !v.groups.Contains(ref.Name) {
+			v.errorf(ref.File, ref.Line, "%s references identity group [%s] which does not exist in configuration", ref.Description, ref.Name)
+		}
+	}
+}
+
+func (v *configValidator) validateAuditDevices() {
+	for _, file := range v.readDir(path.Join(Spec.ConfigurationPath, "audit_devices"), false, false) {
+		var auditDevice AuditDevice
+		v.decode(file, "audit-device", &auditDevice)
+	}
+}
+
+func (v *configValidator) validateAuthMethods() {
+	for _, file := range v.readDir(path.Join(Spec.ConfigurationPath, "auth_methods"), false, true) {
+
+		// Use the filename as the mount path, same as the sync does
+		var m authMethod
+		m.Name = file.Name
+		m.Path = m.Name + "/"
+		if !v.applyRoleListExtends(file) || !v.decode(file, "auth-method", &m) {
+			continue
+		}
+
+		if v.authMounts.Contains(m.Path) {
+			v.errorf(file, file.line("path"), "Auth mount path [%s] is configured more than once", m.Path)
+		}
+		v.authMounts.Add(m.Path)
+
+		if !knownAuthMethodTypes.Contains(m.AuthOptions.Type) {
+			v.warnf(file, file.line("auth_options", "type"), "Unknown auth method type [%s]", m.AuthOptions.Type)
+		}
+
+		switch m.AuthOptions.Type {
+		case "userpass":
+			v.validateUserpassAuth(file)
+		case "ldap":
+			v.validateLDAPAuth(file)
+		case "jwt", "oidc":
+			v.validateAuthRoles(file, "JWT/OIDC", "auth-jwt-role", templateKindJWTRoles)
+		case "approle":
+			v.validateAuthRoles(file, "AppRole", "auth-approle-role", "")
+		case "kubernetes":
+			v.validateAuthRoles(file, "Kubernetes", "auth-kubernetes-role", "")
+		case "aws":
+			v.validateAWSAuth(file)
+		case "cert":
+			v.validateCertAuth(file)
+		case "github":
+			v.validateGitHubAuth(file)
+		case "okta":
+			v.validateOktaAuth(file)
+		case "radius":
+			v.validateRADIUSAuth(file)
+		}
+	}
+}
+
+func (v *configValidator) validateUserpassAuth(file *configFile) {
+	var config struct {
+		AdditionalConfig struct {
+			Users []map[string]interface{} `json:"users"`
+		} `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	for i, user := range config.AdditionalConfig.Users {
+		username, _ := user["username"].(string)
+		if username == "" {
+			continue
+		}
+
+		for _, key := range []string{"policies", "token_policies"} {
+			v.addPolicyRefs(file, file.line("additional_config", "users", i, key), fmt.Sprintf("Userpass user [%s]", username), user[key])
+		}
+
+		if _, ok := user["password"]; ok {
+			v.warnf(file, file.line("additional_config", "users", i, "password"), "Userpass user [%s] has a password in the configuration. It is only used when the user is created, leave it out to have one generated", username)
+		} else if !hasUserpassPasswordOutput() {
+			v.warnf(file, file.line("additional_config", "users", i), "Userpass user [%s] has no password and neither --userpass-password-path nor --output is set, sync stops if the user needs to be created", username)
+		}
+	}
+}
+
+func (v *configValidator) validateLDAPAuth(file *configFile) {
+	var config struct {
+		Config           map[string]interface{} `json:"config"`
+		AdditionalConfig struct {
+			PolicyMap     map[string][]string `json:"policy_map"`
+			UserPolicyMap map[string][]string `json:"user_policy_map"`
+			UserGroupMap  map[string][]string `json:"user_group_map"`
+		} `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	for group, policies := range config.AdditionalConfig.PolicyMap {
+		v.addPolicyRefs(file, file.line("additional_config", "policy_map", group), fmt.Sprintf("LDAP group policy map [%s]", group), policies)
+	}
+	for user, policies := range config.AdditionalConfig.UserPolicyMap {
+		v.addPolicyRefs(file, file.line("additional_config", "user_policy_map", user), fmt.Sprintf("LDAP user policy map [%s]", user), policies)
+	}
+
+	// Names that only differ by case are the same group or user in Vault
+	caseSensitive := ldapCaseSensitiveNames(authMethod{Config: config.Config})
+	for mapName, nameMap := range map[string]map[string][]string{
+		"policy_map":      config.AdditionalConfig.PolicyMap,
+		"user_policy_map": config.AdditionalConfig.UserPolicyMap,
+		"user_group_map":  config.AdditionalConfig.UserGroupMap,
+	} {
+		var sortedNames []string
+		for name := range nameMap {
+			sortedNames = append(sortedNames, name)
+		}
+		sort.Strings(sortedNames)
+
+		names := make(map[string]string)
+		for _, name := range sortedNames {
+			if existing, ok := names[ldapName(name, caseSensitive)]; ok {
+				v.errorf(file, file.line("additional_config", mapName, name), "LDAP %s has [%s] and [%s] which are the same name as case_sensitive_names isn't set", mapName, existing, name)
+			}
+			names[ldapName(name, caseSensitive)] = name
+		}
+	}
+}
+
+func (v *configValidator) validateGitHubAuth(file *configFile) {
+	var config struct {
+		AdditionalConfig AuthMethodGitHubAdditionalConfig `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	for team, policies := range config.AdditionalConfig.Teams {
+		v.addPolicyRefs(file, file.line("additional_config", "teams", team), fmt.Sprintf("GitHub team [%s]", team), policies)
+	}
+	for user, policies := range config.AdditionalConfig.Users {
+		v.addPolicyRefs(file, file.line("additional_config", "users", user), fmt.Sprintf("GitHub user [%s]", user), policies)
+	}
+}
+
+func (v *configValidator) validateOktaAuth(file *configFile) {
+	var config struct {
+		AdditionalConfig AuthMethodOktaAdditionalConfig `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	for group, policies := range config.AdditionalConfig.Groups {
+		v.addPolicyRefs(file, file.line("additional_config", "groups", group), fmt.Sprintf("Okta group [%s]", group), policies)
+	}
+	for name, user := range config.AdditionalConfig.Users {
+		v.addPolicyRefs(file, file.line("additional_config", "users", name, "policies"), fmt.Sprintf("Okta user [%s]", name), user.Policies)
+	}
+}
+
+func (v *configValidator) validateRADIUSAuth(file *configFile) {
+	var config struct {
+		AdditionalConfig AuthMethodRADIUSAdditionalConfig `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	for user, policies := range config.AdditionalConfig.Users {
+		v.addPolicyRefs(file, file.line("additional_config", "users", user), fmt.Sprintf("RADIUS user [%s]", user), policies)
+	}
+}
+
+func (v *configValidator) validateAWSAuth(file *configFile) {
+	var config struct {
+		AdditionalConfig struct {
+			STS []struct {
+				AccountID string `json:"account_id"`
+			} `json:"sts"`
+		} `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) == nil {
+		accountIDs := SecretList{}
+		for i, sts := range config.AdditionalConfig.STS {
+			if accountIDs.Contains(sts.AccountID) {
+				v.errorf(file, file.line("additional_config", "sts", i, "account_id"), "AWS auth STS role for account [%s] is configured more than once", sts.AccountID)
+			}
+			accountIDs.Add(sts.AccountID)
+		}
+	}
+
+	v.validateAuthRoles(file, "AWS auth", "auth-aws-role", "")
+}
+
+// validateCertAuth checks that the certificates in auth_methods/<name>/certs/
+// are valid PEM encoded certificates and validates their metadata
+func (v *configValidator) validateCertAuth(file *configFile) {
+	certsPath := path.Join(Spec.ConfigurationPath, "auth_methods", file.Name, "certs")
+
+	certEntries, metadataEntries, skipped, err := walkCertDirectory(certsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			v.errorf(&configFile{Path: certsPath}, 0, "Unable to read configuration directory: %v", err)
+		}
+		return
+	}
+	for _, filePath := range skipped {
+		v.warnf(&configFile{Path: filePath}, 0, "File does not have a valid extension (%s) and will not be processed", strings.Join(append(append([]string{}, certificateFileExtensions...), configFileExtensions...), ", "))
+	}
+
+	certNames := SecretList{}
+	for _, entry := range certEntries {
+		certNames.Add(entry.Name)
+
+		content, err := ioutil.ReadFile(entry.Path)
+		if err != nil {
+			v.errorf(&configFile{Path: entry.Path}, 0, "Unable to read certificate: %v", err)
+			continue
+		}
+		if err := checkCertificatePEM(content); err != nil {
+			v.errorf(&configFile{Path: entry.Path}, 0, "Invalid certificate: %v", err)
+		}
+	}
+
+	for _, entry := range metadataEntries {
+		metadataFile := v.readFile(entry.Path, true)
+		if metadataFile == nil {
+			continue
+		}
+		metadataFile.Name = entry.Name
+
+		if !certNames.Contains(entry.Name) {
+			v.errorf(metadataFile, 0, "Certificate [%s] has no certificate file (%s)", entry.Name, strings.Join(certificateFileExtensions, ", "))
+		}
+
+		var cert struct {
+			Certificate   string   `json:"certificate"`
+			TokenPolicies []string `json:"token_policies"`
+		}
+		if !v.decode(metadataFile, "auth-cert", &cert) {
+			continue
+		}
+		if cert.Certificate != "" {
+			v.errorf(metadataFile, metadataFile.line("certificate"), "Certificate [%s] can't set the certificate, it is read from its own file", entry.Name)
+		}
+		v.addPolicyRefs(metadataFile, metadataFile.line("token_policies"), fmt.Sprintf("Certificate [%s]", entry.Name), cert.TokenPolicies)
+	}
+}
+
+// validateAuthRoles checks the roles of an auth method, configured in
+// additional_config.roles and auth_methods/<name>/roles/, for duplicates and
+// the policies they reference. Role files extend templates of templateKind,
+// if it is set
+func (v *configValidator) validateAuthRoles(file *configFile, description string, schemaName string, templateKind string) {
+	var config struct {
+		AdditionalConfig struct {
+			Roles []struct {
+				Name          string   `json:"name"`
+				TokenPolicies []string `json:"token_policies"`
+			} `json:"roles"`
+		} `json:"additional_config"`
+	}
+	if json.Unmarshal(file.JSON, &config) != nil {
+		return
+	}
+
+	roleNames := SecretList{}
+	for i, role := range config.AdditionalConfig.Roles {
+		if role.Name == "" {
+			continue
+		}
+
+		if roleNames.Contains(role.Name) {
+			v.errorf(file, file.line("additional_config", "roles", i, "name"), "%s role [%s] is configured more than once", description, role.Name)
+		}
+		roleNames.Add(role.Name)
+
+		v.addPolicyRefs(file, file.line("additional_config", "roles", i, "token_policies"), fmt.Sprintf("%s role [%s]", description, role.Name), role.TokenPolicies)
+	}
+
+	for _, roleFile := range v.readDir(path.Join(Spec.ConfigurationPath, "auth_methods", file.Name, "roles"), false, false) {
+		if templateKind != "" && !v.applyExtends(roleFile, templateKind) {
+			continue
+		}
+
+		var role struct {
+			TokenPolicies []string `json:"token_policies"`
+		}
+		if !v.decode(roleFile, schemaName, &role) {
+			continue
+		}
+
+		if roleNames.Contains(roleFile.Name) {
+			v.errorf(roleFile, 0, "%s role [%s] is configured more than once", description, roleFile.Name)
+		}
+		roleNames.Add(roleFile.Name)
+
+		v.addPolicyRefs(roleFile, roleFile.line("token_policies"), fmt.Sprintf("%s role [%s]", description, roleFile.Name), role.TokenPolicies)
+	}
+}
+
+func (v *configValidator) validateTokenRoles() {
+	for _, file := range v.readDir(path.Join(Spec.ConfigurationPath, "token_roles"), false, false) {
+		var role TokenRole
+		if !v.decode(file, "token-role", &role) {
+			continue
+		}
+
+		description := fmt.Sprintf("Token role [%s]", file.Name)
+		v.addPolicyRefs(file, file.line("allowed_policies"), description, role.AllowedPolicies)
+		v.addPolicyRefs(file, file.line("disallowed_policies"), description, role.DisallowedPolicies)
+	}
+}
+
+func (v *configValidator) validatePolicies() {
+
+	entries, skipped, err := v.walkDir(path.Join(Spec.ConfigurationPath, "policies"), false, isPolicyFile, false)
+	for _, filePath := range skipped {
+		v.warnf(&configFile{Path: filePath}, 0, "File does not have a valid extension (%s) and will not be processed", strings.Join(policyFileExtensions, ", "))
+	}
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		file := &configFile{Path: entry.Path, Name: entry.Name}
+		policyName := entry.Name
+
+		if checkExt(file.Path, ".hcl") {
+			content, err := ioutil.ReadFile(file.Path)
+			if err != nil {
+				v.errorf(file, 0, "Unable to read policy file: %v", err)
+				continue
+			}
+			if content, err = renderTemplate(file.Path, content); err != nil {
+				v.errorf(file, templateErrorLine(file.Path, err), "Invalid template: %v", err)
+				continue
+			}
+			if line, err := parsePolicyHCL(content); err != nil {
+				v.errorf(file, line, "Policy [%s] is not valid HCL: %v", policyName, err)
+				continue
+			}
+			v.policies.Add(policyName)
+			continue
+		}
+
+		if file = v.readFile(file.Path, true); file == nil {
+			continue
+		}
+
+		var policy map[string]interface{}
+		if v.decode(file, "policy", &policy) {
+			v.policies.Add(policyName)
+		}
+	}
+}
+
+func (v *configValidator) validateSecretsEngines() {
+
+	enginesPath := path.Join(Spec.ConfigurationPath, "secrets-engines")
+	engineDirs, err := findSecretsEngineDirs(enginesPath)
+	if err != nil && !os.IsNotExist(err) {
+		v.errorf(&configFile{Path: enginesPath}, 0, "Unable to read configuration directory: %v", err)
+	}
+
+	for _, engineDir := range engineDirs {
+		enginePath := path.Join(enginesPath, engineDir.Path)
+		if engineDir.Path == "identity" {
+			v.validateIdentity(enginePath)
+			continue
+		}
+
+		file := v.readConfigFile(enginePath, "config", true)
+		if file == nil {
+			continue
+		}
+
+		var mountInput VaultApi.MountInput
+		if !v.decode(file, "secrets-engine", &mountInput) {
+			continue
+		}
+
+		if !knownSecretsEnginesTypes.Contains(mountInput.Type) {
+			v.warnf(file, file.line("type"), "Unknown secrets engine type [%s]", mountInput.Type)
+		}
+
+		switch mountInput.Type {
+		case "aws":
+			v.validateAwsSecretsEngine(enginePath)
+		case "database":
+			v.validateDatabaseSecretsEngine(enginePath)
+		}
+	}
+}
+
+func (v *configValidator) validateAwsSecretsEngine(enginePath string) {
+
+	if file := v.readConfigFile(enginePath, "aws", true); file != nil {
+		var secretsEngineAWS SecretsEngineAWS
+		v.decode(file, "secrets-engine-aws", &secretsEngineAWS)
+	}
+
+	for _, file := range v.readDir(path.Join(enginePath, "roles"), false, false) {
+		var role awsRoleEntry
+		if v.applyExtends(file, templateKindAwsRoles) {
+			v.decode(file, "secrets-engine-aws-role", &role)
+		}
+	}
+}
+
+func (v *configValidator) validateDatabaseSecretsEngine(enginePath string) {
+
+	roleNames := SecretList{}
+	for _, file := range v.readDir(path.Join(enginePath, "roles"), true, false) {
+		var role map[string]interface{}
+		roleNames.Add(file.Name)
+		if !v.applyExtends(file, templateKindDatabaseRoles) || !v.decode(file, "secrets-engine-database-role", &role) {
+			continue
+		}
+
+		// The database connection is always written to config/db
+		if dbName, _ := role["db_name"].(string); dbName != "db" {
+			v.errorf(file, file.line("db_name"), "Database role db_name [%s] is invalid, the database connection is always configured as 'db'", dbName)
+		}
+	}
+
+	file := v.readConfigFile(enginePath, "db", true)
+	if file == nil {
+		return
+	}
+
+	var dbConfig struct {
+		PluginName   string      `json:"plugin_name"`
+		AllowedRoles interface{} `json:"allowed_roles"`
+	}
+	if !v.decode(file, "secrets-engine-database", &dbConfig) {
+		return
+	}
+
+	var allowedRoles []string
+	switch roles := dbConfig.AllowedRoles.(type) {
+	case string:
+		allowedRoles = strings.Split(roles, ",")
+	case []interface{}:
+		for _, role := range roles {
+			allowedRoles = append(allowedRoles, fmt.Sprintf("%v", role))
+		}
+	}
+	for _, role := range allowedRoles {
+		if role = strings.TrimSpace(role); role != "*" && !roleNames.Contains(role) {
+			v.errorf(file, file.line("allowed_roles"), "Database config allowed_roles references role [%s] which does not exist in configuration", role)
+		}
+	}
+}
+
+func (v *configValidator) validateIdentity(enginePath string) {
+
+	// Read in groups first so all group names are known
+	groupFiles := v.readDir(path.Join(enginePath, "groups"), true, false)
+	for _, file := range groupFiles {
+		v.groups.Add(file.Name)
+	}
+
+	for _, file := range v.readDir(path.Join(enginePath, "entities"), true, false) {
+		var config EntityConfig
+		if !v.decode(file, "identity-entity", &config) {
+			continue
+		}
+
+		description := fmt.Sprintf("Identity entity [%s]", file.Name)
+		v.addPolicyRefs(file, file.line("entity", "policies"), description, config.Entity.Policies)
+
+		for i, alias := range config.EntityAliases {
+			v.validateAlias(file, alias, description, "entity-aliases", i)
+		}
+
+		for i, group := range config.EntityGroups {
+			v.groupRefs = append(v.groupRefs, configReference{Name: group, File: file, Line: file.line("entity-groups", i), Description: description})
+		}
+	}
+
+	for _, file := range groupFiles {
+		var config GroupConfig
+		if !v.applyExtends(file, templateKindIdentityGroups) || !v.decode(file, "identity-group", &config) {
+			continue
+		}
+
+		description := fmt.Sprintf("Identity group [%s]", file.Name)
+		v.addPolicyRefs(file, file.line("group", "policies"), description, config.Group.Policies)
+
+		if config.GroupAlias.Name != "" || config.GroupAlias.MountPath != "" || config.GroupAlias.MountAccessor != "" {
+			if config.Group.Type != "external" {
+				v.errorf(file, file.line("group-alias"), "%s has a group-alias but only external groups can have aliases", description)
+			}
+			v.validateAlias(file, config.GroupAlias, description, "group-alias")
+		}
+
+		for i, group := range config.GroupGroups {
+			v.groupRefs = append(v.groupRefs, configReference{Name: group, File: file, Line: file.line("group-groups", i), Description: description})
+		}
+	}
+}
+
+func (v *configValidator) validateAlias(file *configFile, alias identity.Alias, description string, keys ...interface{}) {
+	line := file.line(keys...)
+
+	if alias.MountAccessor != "" && alias.MountPath != "" {
+		v.errorf(file, line, "Alias for %s has both 'mount_accessor' and 'mount_path', only one can be specified", description)
+	} else if alias.MountAccessor == "" && alias.MountPath == "" {
+		v.errorf(file, line, "Alias for %s is missing 'mount_accessor' or 'mount_path'", description)
+	} else if alias.MountPath != "" {
+		v.mountRefs = append(v.mountRefs, configReference{Name: alias.MountPath, File: file, Line: file.line(append(keys, "mount_path")...), Description: fmt.Sprintf("Alias for %s", description)})
+	}
+}
+
+// line returns the line number of the value at the given path of mapping keys
+// (string) and sequence indexes (int). If the full path doesn't exist, the
+// line of the closest parent is returned
+func (file *configFile) line(keys ...interface{}) int {
+	if file.root == nil || len(file.root.Content) == 0 {
+		return 1
+	}
+
+	node := file.root.Content[0]
+	line := node.Line
+	for _, key := range keys {
+		var next *yaml.Node
+		switch k := key.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == k {
+						line = node.Content[i].Line
+						next = node.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && k < len(node.Content) {
+				next = node.Content[k]
+				line = next.Line
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return line
+}
+
+// offsetLine returns the line number of a byte offset within a JSON file.
+// Offsets for YAML files refer to the converted JSON so aren't useful
+func (file *configFile) offsetLine(offset int64) int {
+	if !checkExt(file.Path, ".json") {
+		return 0
+	}
+	if offset > int64(len(file.Content)) {
+		offset = int64(len(file.Content))
+	}
+	return strings.Count(string(file.Content[:offset]), "\n") + 1
+}
+
+// yamlErrorLine returns the line number from a YAML parsing error
+func yamlErrorLine(err error) int {
+	if match := regexp.MustCompile(`line (\d+)`).FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return line
+	}
+	return 0
+}
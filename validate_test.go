@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// validateTestConfig validates a configuration directory of the given files
+// and returns the errors and warnings found, as "<file>:<line>: <message>"
+// with the file relative to the configuration directory
+func validateTestConfig(t *testing.T, files map[string]string) ([]string, []string) {
+	t.Helper()
+
+	dir := writeConfigDir(t, files)
+	v := configValidator{}
+	v.validate()
+	v.report()
+
+	var errors, warnings []string
+	for _, problem := range v.problems {
+		file, err := filepath.Rel(dir, problem.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message := fmt.Sprintf("%s:%d: %s", filepath.ToSlash(file), problem.Line, problem.Message)
+		if problem.Warning {
+			warnings = append(warnings, message)
+		} else {
+			errors = append(errors, message)
+		}
+	}
+
+	return errors, warnings
+}
+
+const testPolicy = `{"path": {"secret/*": {"capabilities": ["read"]}}}`
+
+func TestValidateConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		errors   []string
+		warnings []string
+
+		// Generated userpass passwords can't be handed off
+		noPasswordOutput bool
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"policies/app.json": testPolicy,
+				"auth_methods/userpass.json": `{
+  "auth_options": {"type": "userpass"},
+  "additional_config": {"users": [{"username": "app", "policies": "default, app"}]}
+}`,
+			},
+		},
+		{
+			name: "missing policy",
+			files: map[string]string{
+				"auth_methods/userpass.json": `{
+  "auth_options": {"type": "userpass"},
+  "additional_config": {
+    "users": [
+      {"username": "app", "policies": "default, app"}
+    ]
+  }
+}`,
+			},
+			errors: []string{"auth_methods/userpass.json:5: Userpass user [app] references policy [app] which does not exist in configuration"},
+		},
+		{
+			name: "userpass user without a password output",
+			files: map[string]string{
+				"auth_methods/userpass.json": `{
+  "auth_options": {"type": "userpass"},
+  "additional_config": {"users": [{"username": "app"}, {"username": "admin", "password": "p"}]}
+}`,
+			},
+			noPasswordOutput: true,
+			warnings: []string{
+				"auth_methods/userpass.json:3: Userpass user [app] has no password and neither --userpass-password-path nor --output is set, sync stops if the user needs to be created",
+				"auth_methods/userpass.json:3: Userpass user [admin] has a password in the configuration. It is only used when the user is created, leave it out to have one generated",
+			},
+		},
+		{
+			name: "invalid JSON",
+			files: map[string]string{
+				"policies/app.json": "{\n  \"path\": \n}",
+			},
+			errors: []string{"policies/app.json:3: Invalid JSON: invalid character '}' looking for beginning of value"},
+		},
+		{
+			name: "invalid token role duration",
+			files: map[string]string{
+				"token_roles/ci.yaml": "token_period: 1h\ntoken_explicit_max_ttl: 1 week\n",
+			},
+			errors: []string{"token_roles/ci.yaml:2: Invalid value [1 week] for 'token_explicit_max_ttl', expected a number of seconds or a duration string (i.e. 1h, 30m or 7d)"},
+		},
+		{
+			name: "invalid auth role duration",
+			files: map[string]string{
+				"auth_methods/approle.json":           `{"auth_options": {"type": "approle"}}`,
+				"auth_methods/approle/roles/ci.yaml":  "token_ttl: 1x\ntoken_period: -5\n",
+				"auth_methods/approle/roles/app.yaml": "token_ttl: 1h\ntoken_max_ttl: 7200\n",
+			},
+			errors: []string{
+				"auth_methods/approle/roles/ci.yaml:1: Invalid value [1x] for 'token_ttl', expected a number of seconds or a duration string (i.e. 1h, 30m or 7d)",
+				"auth_methods/approle/roles/ci.yaml:2: Invalid value [-5] for 'token_period', must be at least 0",
+			},
+		},
+		{
+			name: "unknown auth method type",
+			files: map[string]string{
+				"auth_methods/custom.json": `{"auth_options": {"type": "custom"}}`,
+			},
+			warnings: []string{"auth_methods/custom.json:1: Unknown auth method type [custom]"},
+		},
+		{
+			name: "file without a valid extension",
+			files: map[string]string{
+				"policies/app.txt": testPolicy,
+			},
+			warnings: []string{"policies/app.txt:0: File does not have a valid extension (.hcl, .json, .yaml, .yml) and will not be processed"},
+		},
+		{
+			name: "missing identity group and auth mount",
+			files: map[string]string{
+				"policies/app.json":                              testPolicy,
+				"secrets-engines/identity/groups/app.json":       `{"group": {"type": "internal", "policies": ["app"]}}`,
+				"secrets-engines/identity/entities/service.json": "{\n  \"entity-aliases\": [{\"name\": \"service\", \"mount_path\": \"approle/\"}],\n  \"entity-groups\": [\"app\", \"ops\"]\n}",
+			},
+			errors: []string{
+				"secrets-engines/identity/entities/service.json:2: Alias for Identity entity [service] references auth mount_path [approle/] which does not exist in configuration. Ensure it is in the format '<path>/'",
+				"secrets-engines/identity/entities/service.json:3: Identity entity [service] references identity group [ops] which does not exist in configuration",
+			},
+		},
+		{
+			name: "required fields from templates",
+			files: map[string]string{
+				"templates/jwt-roles/base.yaml":         "role_type: jwt\n",
+				"templates/jwt-roles/named.yaml":        "name: shared\n",
+				"templates/aws-roles/base.yaml":         "default_sts_ttl: 1h\n",
+				"templates/aws-roles/iam.yaml":          "credential_type: iam_user\n",
+				"secrets-engines/aws/config.json":       `{"type": "aws"}`,
+				"secrets-engines/aws/aws.json":          `{}`,
+				"secrets-engines/aws/roles/deploy.yaml": "extends: base\n",
+				"secrets-engines/aws/roles/app.yaml":    "extends: iam\n",
+				"auth_methods/jwt.yaml": `auth_options:
+  type: jwt
+additional_config:
+  roles:
+    - extends: base
+    - extends: named
+`,
+			},
+			errors: []string{
+				"auth_methods/jwt.yaml:5: Missing required field 'additional_config.roles[0].name'",
+				"secrets-engines/aws/roles/deploy.yaml:1: Missing required field 'credential_type'",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.noPasswordOutput {
+				setSpec(t, &Spec.UserpassPasswords, "secret/userpass")
+			}
+			errors, warnings := validateTestConfig(t, test.files)
+			if !reflect.DeepEqual(errors, test.errors) {
+				t.Errorf("errors = %q, want %q", errors, test.errors)
+			}
+			if !reflect.DeepEqual(warnings, test.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, test.warnings)
+			}
+		})
+	}
+}
+
+func TestConfigFileLine(t *testing.T) {
+	content := `# Comment
+name: app
+roles:
+  - name: a
+    policies: [x]
+  - name: b
+    policies:
+      - y
+`
+	dir := writeConfigDir(t, map[string]string{"auth_methods/app.yaml": content})
+	v := configValidator{}
+	file := v.readFile(filepath.Join(dir, "auth_methods/app.yaml"), true)
+	if file == nil {
+		t.Fatalf("readFile() failed: %v", v.problems)
+	}
+
+	tests := []struct {
+		keys []interface{}
+		want int
+	}{
+		{keys: nil, want: 2},
+		{keys: []interface{}{"name"}, want: 2},
+		{keys: []interface{}{"roles"}, want: 3},
+		{keys: []interface{}{"roles", 1}, want: 6},
+		{keys: []interface{}{"roles", 1, "policies", 0}, want: 8},
+		{keys: []interface{}{"roles", 0, "policies"}, want: 5},
+		// Missing keys return the line of the closest parent
+		{keys: []interface{}{"roles", 1, "ttl"}, want: 6},
+		{keys: []interface{}{"roles", 5}, want: 3},
+		{keys: []interface{}{"missing"}, want: 2},
+	}
+
+	for _, test := range tests {
+		if got := file.line(test.keys...); got != test.want {
+			t.Errorf("line(%v) = %d, want %d", test.keys, got, test.want)
+		}
+	}
+}